@@ -0,0 +1,126 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.2
+// source: api/issuer.proto
+
+package api
+
+import (
+	context "context"
+
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Issuer_IssueCertificate_FullMethodName = "/example.issuer.Issuer/IssueCertificate"
+)
+
+// IssuerClient is the client API for Issuer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Signs short-lived certificates for authenticated callers.
+type IssuerClient interface {
+	IssueCertificate(ctx context.Context, in *IssueCertificateRequest, opts ...grpc.CallOption) (*IssueCertificateResponse, error)
+}
+
+type issuerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIssuerClient(cc grpc.ClientConnInterface) IssuerClient {
+	return &issuerClient{cc}
+}
+
+func (c *issuerClient) IssueCertificate(ctx context.Context, in *IssueCertificateRequest, opts ...grpc.CallOption) (*IssueCertificateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IssueCertificateResponse)
+	err := c.cc.Invoke(ctx, Issuer_IssueCertificate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IssuerServer is the server API for Issuer service.
+// All implementations must embed UnimplementedIssuerServer
+// for forward compatibility.
+//
+// Signs short-lived certificates for authenticated callers.
+type IssuerServer interface {
+	IssueCertificate(context.Context, *IssueCertificateRequest) (*IssueCertificateResponse, error)
+	mustEmbedUnimplementedIssuerServer()
+}
+
+// UnimplementedIssuerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIssuerServer struct{}
+
+func (UnimplementedIssuerServer) IssueCertificate(context.Context, *IssueCertificateRequest) (*IssueCertificateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IssueCertificate not implemented")
+}
+func (UnimplementedIssuerServer) mustEmbedUnimplementedIssuerServer() {}
+func (UnimplementedIssuerServer) testEmbeddedByValue()                {}
+
+// UnsafeIssuerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IssuerServer will
+// result in compilation errors.
+type UnsafeIssuerServer interface {
+	mustEmbedUnimplementedIssuerServer()
+}
+
+func RegisterIssuerServer(s grpc.ServiceRegistrar, srv IssuerServer) {
+	// If the following call pancis, it indicates UnimplementedIssuerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Issuer_ServiceDesc, srv)
+}
+
+func _Issuer_IssueCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssueCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IssuerServer).IssueCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Issuer_IssueCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IssuerServer).IssueCertificate(ctx, req.(*IssueCertificateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Issuer_ServiceDesc is the grpc.ServiceDesc for Issuer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Issuer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "example.issuer.Issuer",
+	HandlerType: (*IssuerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "IssueCertificate",
+			Handler:    _Issuer_IssueCertificate_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/issuer.proto",
+}
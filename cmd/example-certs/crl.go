@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func revokeCmd(args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	out := fs.String("out", "target", "output directory, which must hold the CA")
+	caName := fs.String("ca", "ca", "name of the CA that issued the certificates")
+	serials := fs.String("serial", "", "comma-separated hex serial numbers to revoke, as well as any certificate files given as arguments")
+	cns := fs.String("cn", "", "comma-separated common names whose current certificates are revoked")
+	nextUpdate := fs.Duration("next-update", 7*24*time.Hour, "how long the CRL is valid for")
+	caPass := addCAPassphraseFlag(fs)
+	_ = fs.Parse(args)
+
+	ca, err := loadCA(*out, *caName, *caPass)
+	if err != nil {
+		return err
+	}
+	idx, err := loadIndex(*out)
+	if err != nil {
+		return err
+	}
+	issued := idx.issuedBy(ca)
+	now := time.Now()
+	revoke := func(entry *indexEntry) {
+		if entry.RevokedAt == nil {
+			entry.RevokedAt = &now
+		}
+		log.Printf("revoked %s cert with serial %s\n", entry.CommonName, entry.Serial)
+	}
+	bySerial := func(serial *big.Int) error {
+		for _, entry := range issued {
+			if entry.serialNumber().Cmp(serial) == 0 {
+				revoke(entry)
+				return nil
+			}
+		}
+		return fmt.Errorf("%s has not issued a cert with serial %x", ca.name, serial)
+	}
+	for _, value := range splitList(*serials) {
+		serial, ok := new(big.Int).SetString(value, 16)
+		if !ok {
+			return fmt.Errorf("invalid serial number: %s", value)
+		}
+		if err = bySerial(serial); err != nil {
+			return err
+		}
+	}
+	for _, cn := range splitList(*cns) {
+		found := false
+		for _, entry := range issued {
+			if entry.CommonName == cn && idx.status(entry, now) == statusValid {
+				revoke(entry)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s has no current cert for %s", ca.name, cn)
+		}
+	}
+	for _, certFile := range fs.Args() {
+		certs, err := readCertificates(certFile)
+		if err != nil {
+			return err
+		}
+		// any other certs in the file are the issuing CAs
+		if certs[0].CheckSignatureFrom(ca.cert) != nil {
+			return fmt.Errorf("%s was not issued by %s", certFile, ca.cert.Subject.CommonName)
+		}
+		if err = bySerial(certs[0].SerialNumber); err != nil {
+			return err
+		}
+	}
+	if err = idx.save(*out); err != nil {
+		return err
+	}
+	return ca.writeCRL(*out, revocations(issued), now, *nextUpdate)
+}
+
+func crlCmd(args []string) error {
+	fs := flag.NewFlagSet("crl", flag.ExitOnError)
+	out := fs.String("out", "target", "output directory, which must hold the CA")
+	caName := fs.String("ca", "ca", "name of the CA that signs the CRL")
+	nextUpdate := fs.Duration("next-update", 7*24*time.Hour, "how long the CRL is valid for")
+	caPass := addCAPassphraseFlag(fs)
+	_ = fs.Parse(args)
+
+	ca, err := loadCA(*out, *caName, *caPass)
+	if err != nil {
+		return err
+	}
+	idx, err := loadIndex(*out)
+	if err != nil {
+		return err
+	}
+	revoked := revocations(idx.issuedBy(ca))
+	log.Printf("%s CRL lists %d revoked certs\n", ca.name, len(revoked))
+	return ca.writeCRL(*out, revoked, time.Now(), *nextUpdate)
+}
+
+func revocations(entries []*indexEntry) []x509.RevocationListEntry {
+	var revoked []x509.RevocationListEntry
+	for _, entry := range entries {
+		if entry.RevokedAt != nil {
+			revoked = append(revoked, x509.RevocationListEntry{
+				SerialNumber:   entry.serialNumber(),
+				RevocationTime: *entry.RevokedAt,
+			})
+		}
+	}
+	return revoked
+}
+
+func (c *certAuthority) writeCRL(dir string, revoked []x509.RevocationListEntry, now time.Time, nextUpdate time.Duration) error {
+	tmpl := &x509.RevocationList{
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(nextUpdate),
+		RevokedCertificateEntries: revoked,
+	}
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, tmpl, c.cert, c.key)
+	if err != nil {
+		return fmt.Errorf("generate crl: %w", err)
+	}
+	fp, err := os.Create(filepath.Join(dir, c.name+".crl"))
+	if err != nil {
+		return fmt.Errorf("write crl: %w", err)
+	}
+	defer fp.Close()
+
+	return pem.Encode(fp, &pem.Block{
+		Type:  "X509 CRL",
+		Bytes: crlBytes,
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const indexFile = "index.json"
+
+// certificate statuses
+const (
+	statusValid      = "valid"
+	statusExpired    = "expired"
+	statusRevoked    = "revoked"
+	statusSuperseded = "superseded"
+)
+
+// indexEntry records a certificate issued by example-certs. CAs can be
+// re-created with the same name, so issuers are also tracked by serial.
+type indexEntry struct {
+	Serial       string     `json:"serial"`
+	Name         string     `json:"name"`
+	CommonName   string     `json:"common_name"`
+	Subject      string     `json:"subject"`
+	IsCA         bool       `json:"is_ca,omitempty"`
+	Issuer       string     `json:"issuer"`
+	IssuerSerial string     `json:"issuer_serial"`
+	NotBefore    time.Time  `json:"not_before"`
+	NotAfter     time.Time  `json:"not_after"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// certIndex is the inventory of issued certificates, oldest first.
+type certIndex struct {
+	Certificates []*indexEntry `json:"certificates"`
+}
+
+func loadIndex(dir string) (*certIndex, error) {
+	idx := &certIndex{}
+	buf, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read index: %w", err)
+	}
+	if err = json.Unmarshal(buf, idx); err != nil {
+		return nil, fmt.Errorf("cannot parse index: %w", err)
+	}
+	return idx, nil
+}
+
+func (idx *certIndex) save(dir string) error {
+	buf, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write & rename so that a failed write does not lose the index
+	tmpFile := filepath.Join(dir, indexFile+".tmp")
+	if err = os.WriteFile(tmpFile, append(buf, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write index: %w", err)
+	}
+	return os.Rename(tmpFile, filepath.Join(dir, indexFile))
+}
+
+func (idx *certIndex) add(entry *indexEntry) {
+	idx.Certificates = append(idx.Certificates, entry)
+}
+
+// issuedBy returns the certificates issued by the CA.
+func (idx *certIndex) issuedBy(ca *certAuthority) []*indexEntry {
+	serial := fmt.Sprintf("%x", ca.cert.SerialNumber)
+	var res []*indexEntry
+	for _, entry := range idx.Certificates {
+		if entry.IssuerSerial == serial && entry.Serial != serial {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// status of an entry, where newer certificates with
+// the same file name supersede the older ones
+func (idx *certIndex) status(entry *indexEntry, now time.Time) string {
+	switch {
+	case entry.RevokedAt != nil:
+		return statusRevoked
+	case now.After(entry.NotAfter):
+		return statusExpired
+	}
+	for i := len(idx.Certificates) - 1; i >= 0; i-- {
+		if latest := idx.Certificates[i]; latest.Name == entry.Name {
+			if latest != entry {
+				return statusSuperseded
+			}
+			break
+		}
+	}
+	return statusValid
+}
+
+func (e *indexEntry) serialNumber() *big.Int {
+	serial, _ := new(big.Int).SetString(e.Serial, 16)
+	return serial
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func listCmd(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	out := fs.String("out", "target", "output directory")
+	expiring := fs.Duration("expiring", 0, "only list current certificates that expire within this duration")
+	all := fs.Bool("all", false, "include superseded certificates")
+	_ = fs.Parse(args)
+
+	idx, err := loadIndex(*out)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSERIAL\tSUBJECT\tISSUER\tNOT AFTER\tSTATUS")
+	for _, entry := range idx.Certificates {
+		status := idx.status(entry, now)
+		if status == statusSuperseded && !*all {
+			continue
+		}
+		if *expiring > 0 {
+			current := status == statusValid || status == statusExpired
+			if !current || entry.NotAfter.After(now.Add(*expiring)) {
+				continue
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Name, entry.Serial, entry.Subject, entry.Issuer,
+			entry.NotAfter.Local().Format(time.DateTime), status)
+	}
+	return tw.Flush()
+}
+
+func inspectCmd(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: example-certs inspect <cert file>...")
+	}
+	for _, file := range fs.Args() {
+		certs, err := readCertificates(file)
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			fmt.Printf("%s:\n", file)
+			printCertificate(cert)
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+func printCertificate(cert *x509.Certificate) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "  Subject:\t%s\n", cert.Subject)
+	fmt.Fprintf(tw, "  Issuer:\t%s\n", cert.Issuer)
+	fmt.Fprintf(tw, "  Serial:\t%x\n", cert.SerialNumber)
+	fmt.Fprintf(tw, "  Not before:\t%s\n", cert.NotBefore.Local().Format(time.DateTime))
+	fmt.Fprintf(tw, "  Not after:\t%s\n", cert.NotAfter.Local().Format(time.DateTime))
+	fmt.Fprintf(tw, "  Key:\t%s\n", describeKey(cert.PublicKey))
+	if cert.IsCA {
+		switch {
+		case cert.MaxPathLen > 0 || cert.MaxPathLenZero:
+			fmt.Fprintf(tw, "  CA:\ttrue, path length %d\n", cert.MaxPathLen)
+		default:
+			fmt.Fprintf(tw, "  CA:\ttrue\n")
+		}
+	}
+	if len(cert.DNSNames) > 0 {
+		fmt.Fprintf(tw, "  DNS SANs:\t%s\n", strings.Join(cert.DNSNames, ", "))
+	}
+	if len(cert.IPAddresses) > 0 {
+		ips := make([]string, len(cert.IPAddresses))
+		for i, ip := range cert.IPAddresses {
+			ips[i] = ip.String()
+		}
+		fmt.Fprintf(tw, "  IP SANs:\t%s\n", strings.Join(ips, ", "))
+	}
+	if len(cert.URIs) > 0 {
+		uris := make([]string, len(cert.URIs))
+		for i, uri := range cert.URIs {
+			uris[i] = uri.String()
+		}
+		fmt.Fprintf(tw, "  URI SANs:\t%s\n", strings.Join(uris, ", "))
+	}
+	if len(cert.EmailAddresses) > 0 {
+		fmt.Fprintf(tw, "  Email SANs:\t%s\n", strings.Join(cert.EmailAddresses, ", "))
+	}
+	var usages []string
+	for _, usage := range cert.ExtKeyUsage {
+		switch usage {
+		case x509.ExtKeyUsageClientAuth:
+			usages = append(usages, "client")
+		case x509.ExtKeyUsageServerAuth:
+			usages = append(usages, "server")
+		default:
+			usages = append(usages, fmt.Sprintf("%d", usage))
+		}
+	}
+	if len(usages) > 0 {
+		fmt.Fprintf(tw, "  Usage:\t%s\n", strings.Join(usages, ", "))
+	}
+	if len(cert.OCSPServer) > 0 {
+		fmt.Fprintf(tw, "  OCSP:\t%s\n", strings.Join(cert.OCSPServer, ", "))
+	}
+	fmt.Fprintf(tw, "  SHA-256:\t%x\n", sha256.Sum256(cert.Raw))
+}
+
+func describeKey(pub any) string {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+func readCertificates(certFile string) ([]*x509.Certificate, error) {
+	buf, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read certificate: %w", err)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, buf = pem.Decode(buf)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("bad certificate in %s: %w", certFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", certFile)
+	}
+	return certs, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/tomcz/example-grpc/tlsconfig"
+)
+
+// key formats
+const (
+	formatPKCS8  = "pkcs8"
+	formatLegacy = "legacy"
+)
+
+type keyFlags struct {
+	keyType        *string
+	format         *string
+	passphraseFile *string
+}
+
+func addKeyFlags(fs *flag.FlagSet) keyFlags {
+	return keyFlags{
+		keyType:        fs.String("key", keyRSA4096, "key type (rsa2048, rsa3072, rsa4096, p256, p384 or ed25519)"),
+		format:         fs.String("key-format", formatPKCS8, "private key format (pkcs8, or legacy for PKCS#1 & SEC1)"),
+		passphraseFile: fs.String("key-passphrase-file", "", "encrypt the private key with the passphrase in this file (or env KEY_PASSPHRASE)"),
+	}
+}
+
+func (k keyFlags) newPrivateKey() (crypto.Signer, error) {
+	if *k.format != formatPKCS8 && *k.format != formatLegacy {
+		return nil, fmt.Errorf("unsupported key format: %s", *k.format)
+	}
+	return newPrivateKey(*k.keyType)
+}
+
+func (k keyFlags) writePrivateKey(privKey crypto.Signer, outfile string) error {
+	passphrase, err := readPassphrase(*k.passphraseFile, "KEY_PASSPHRASE")
+	if err != nil {
+		return err
+	}
+	var block *pem.Block
+	switch {
+	case len(passphrase) > 0:
+		if *k.format != formatPKCS8 {
+			return fmt.Errorf("encrypted keys must use the %s format", formatPKCS8)
+		}
+		buf, err := pkcs8.MarshalPrivateKey(privKey, passphrase, nil)
+		if err != nil {
+			return err
+		}
+		block = &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: buf}
+	case *k.format == formatLegacy:
+		if block, err = legacyKeyBlock(privKey); err != nil {
+			return err
+		}
+	default:
+		buf, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			return err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: buf}
+	}
+	fp, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	return pem.Encode(fp, block)
+}
+
+// readPassphrase reads a passphrase from a file, or else from an environment variable.
+func readPassphrase(filename, envVar string) ([]byte, error) {
+	if filename != "" {
+		return tlsconfig.ReadPassphrase(filename)
+	}
+	return []byte(os.Getenv(envVar)), nil
+}
+
+// key types
+const (
+	keyRSA2048 = "rsa2048"
+	keyRSA3072 = "rsa3072"
+	keyRSA4096 = "rsa4096"
+	keyP256    = "p256"
+	keyP384    = "p384"
+	keyEd25519 = "ed25519"
+)
+
+func newPrivateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case keyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case keyRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case keyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case keyP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case keyP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case keyEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+func writeCertificate(outfile string, certBytes []byte, chain ...[]byte) error {
+	fp, err := os.Create(outfile)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	for _, buf := range append([][]byte{certBytes}, chain...) {
+		err = pem.Encode(fp, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: buf,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func legacyKeyBlock(privKey crypto.Signer) (*pem.Block, error) {
+	switch pk := privKey.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(pk),
+		}, nil
+	case *ecdsa.PrivateKey:
+		buf, err := x509.MarshalECPrivateKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: buf,
+		}, nil
+	default:
+		// there is no legacy format for ed25519 keys
+		buf, err := x509.MarshalPKCS8PrivateKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: buf,
+		}, nil
+	}
+}
@@ -1,182 +1,345 @@
 package main
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"bytes"
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"flag"
 	"fmt"
 	"log"
 	"math/big"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/tomcz/example-grpc/tlsconfig"
 )
 
-var useElliptic bool
+const usage = `usage: example-certs <command> [flags]
+
+commands:
+  init-ca  create a root or intermediate CA
+  issue    issue a certificate signed by the CA
+  revoke   revoke certificates, and update the CA's CRL
+  crl      re-create a CA's CRL from the index
+  list     list the certificates in the index
+  inspect  show the details of certificate files
+
+Run "example-certs <command> -h" for command flags.
+`
 
 func main() {
-	useElliptic = os.Getenv("USE_EC_KEYS") == "yes"
-	if err := realMain(); err != nil {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "init-ca":
+		err = initCACmd(os.Args[2:])
+	case "issue":
+		err = issueCmd(os.Args[2:])
+	case "revoke":
+		err = revokeCmd(os.Args[2:])
+	case "crl":
+		err = crlCmd(os.Args[2:])
+	case "list":
+		err = listCmd(os.Args[2:])
+	case "inspect":
+		err = inspectCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
 		log.Fatalln(err)
 	}
 }
 
-func realMain() error {
-	now := time.Now()
-	ca, err := createRootCA(now)
+func initCACmd(args []string) error {
+	fs := flag.NewFlagSet("init-ca", flag.ExitOnError)
+	out := fs.String("out", "target", "output directory")
+	name := fs.String("name", "ca", "CA file name, without extension")
+	parent := fs.String("parent", "", "name of the CA that signs this one, to create an intermediate CA instead of a root")
+	pathLen := fs.Int("path-len", -1, "maximum number of intermediate CAs below this one (defaults to unlimited for roots, and 0 for intermediates)")
+	cn := fs.String("cn", "example root ca", "CA common name")
+	org := fs.String("org", "example grpc", "CA organization")
+	validity := fs.Duration("validity", 10*365*24*time.Hour, "CA certificate lifetime")
+	kf := addKeyFlags(fs)
+	caPass := addCAPassphraseFlag(fs)
+	_ = fs.Parse(args)
+
+	privKey, err := kf.newPrivateKey()
 	if err != nil {
 		return err
 	}
-	err = ca.createCert("server", now)
+	serial, err := newSerial()
 	if err != nil {
 		return err
 	}
-	err = ca.createCert("alice", now)
+	now := time.Now()
+	cert := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               newSubject(*cn, *org),
+		NotBefore:             now,
+		NotAfter:              now.Add(*validity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	// self-signed unless there is a parent
+	issuer, signer := cert, crypto.Signer(privKey)
+	var chain [][]byte
+	if *parent != "" {
+		ca, err := loadCA(*out, *parent, *caPass)
+		if err != nil {
+			return err
+		}
+		if cert.NotAfter.After(ca.cert.NotAfter) {
+			cert.NotAfter = ca.cert.NotAfter
+		}
+		if *pathLen < 0 {
+			*pathLen = 0
+		}
+		issuer, signer, chain = ca.cert, ca.key, ca.chain
+	}
+	if *pathLen >= 0 {
+		cert.MaxPathLen = *pathLen
+		cert.MaxPathLenZero = *pathLen == 0
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, cert, issuer, privKey.Public(), signer)
 	if err != nil {
-		return err
+		return fmt.Errorf("generate %s cert: %w", *name, err)
+	}
+	if err = writeCertificate(filepath.Join(*out, *name+".crt"), certBytes, chain...); err != nil {
+		return fmt.Errorf("write %s cert: %w", *name, err)
 	}
-	err = ca.createCert("bob", now)
+	if err = kf.writePrivateKey(privKey, filepath.Join(*out, *name+".key")); err != nil {
+		return fmt.Errorf("write %s key: %w", *name, err)
+	}
+	log.Printf("created %s with serial %x\n", *cn, serial)
+	// signing CRLs needs the generated subject key ID
+	cert, err = x509.ParseCertificate(certBytes)
 	if err != nil {
+		return fmt.Errorf("parse %s cert: %w", *name, err)
+	}
+	ca := &certAuthority{name: *name, cert: cert, key: privKey}
+	issuerName := *name
+	if *parent != "" {
+		ca.chain = append([][]byte{certBytes}, chain...)
+		issuerName = *parent
+	}
+	if err = recordCert(*out, *name, issuerName, cert); err != nil {
 		return err
 	}
-	return nil
+	// start with an empty CRL so that servers always have one to load
+	return ca.writeCRL(*out, nil, now, 7*24*time.Hour)
 }
 
-type rootCA struct {
-	cert *x509.Certificate
-	key  any
-}
+func issueCmd(args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	out := fs.String("out", "target", "output directory, which must hold the CA")
+	caName := fs.String("ca", "ca", "name of the issuing CA")
+	cn := fs.String("cn", "", "certificate common name (required)")
+	name := fs.String("name", "", "output file name, without extension (defaults to the first label of the common name)")
+	org := fs.String("org", "example grpc", "certificate organization")
+	dnsSANs := fs.String("dns", "", "comma-separated DNS SANs (defaults to the common name)")
+	ipSANs := fs.String("ip", "", "comma-separated IP address SANs")
+	uriSANs := fs.String("uri", "", "comma-separated URI SANs (e.g. spiffe://example.org/ns/default/sa/alice)")
+	emailSANs := fs.String("email", "", "comma-separated email SANs")
+	validity := fs.Duration("validity", 30*24*time.Hour, "certificate lifetime")
+	kf := addKeyFlags(fs)
+	caPass := addCAPassphraseFlag(fs)
+	usages := fs.String("usage", "client,server", "comma-separated extended key usages (client, server)")
+	ocspURL := fs.String("ocsp-url", "", "OCSP responder URL to include in the certificate")
+	_ = fs.Parse(args)
 
-func createRootCA(now time.Time) (*rootCA, error) {
-	log.Println("generating root ca")
+	if *cn == "" {
+		return fmt.Errorf("-cn is required")
+	}
+	if *name == "" {
+		*name, _, _ = strings.Cut(*cn, ".")
+	}
+	ca, err := loadCA(*out, *caName, *caPass)
+	if err != nil {
+		return err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
 	cert := &x509.Certificate{
-		SerialNumber: big.NewInt(2023),
-		Subject: pkix.Name{
-			CommonName:    "example root ca",
-			Country:       []string{"AU"},
-			Organization:  []string{"example grpc"},
-			Locality:      []string{"Brisbane"},
-			Province:      []string{"Queensland"},
-			StreetAddress: []string{"Adelaide Street"},
-			PostalCode:    []string{"4000"},
-		},
-		NotBefore:             now,
-		NotAfter:              now.AddDate(10, 0, 0),
-		IsCA:                  true,
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
+		SerialNumber: serial,
+		Subject:      newSubject(*cn, *org),
+		NotBefore:    now,
+		NotAfter:     now.Add(*validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if cert.NotAfter.After(ca.cert.NotAfter) {
+		cert.NotAfter = ca.cert.NotAfter
+	}
+	if err = addSANs(cert, *dnsSANs, *ipSANs, *uriSANs, *emailSANs); err != nil {
+		return err
+	}
+	for _, usage := range splitList(*usages) {
+		switch usage {
+		case "client":
+			cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+		case "server":
+			cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		default:
+			return fmt.Errorf("unknown usage: %s", usage)
+		}
 	}
-	privKey, err := newPrivateKey()
+	if *ocspURL != "" {
+		cert.OCSPServer = []string{*ocspURL}
+	}
+	privKey, err := kf.newPrivateKey()
 	if err != nil {
-		return nil, fmt.Errorf("generate ca pk: %w", err)
+		return err
 	}
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, publicKeyFor(privKey), privKey)
+	certBytes, err := x509.CreateCertificate(rand.Reader, cert, ca.cert, privKey.Public(), ca.key)
 	if err != nil {
-		return nil, fmt.Errorf("generate ca cert: %w", err)
+		return fmt.Errorf("generate %s cert: %w", *name, err)
 	}
-	if err = writeCertificate(certBytes, "target/ca.crt"); err != nil {
-		return nil, fmt.Errorf("write ca cert: %w", err)
+	// TLS peers need to send the intermediate CAs along with their own cert
+	if err = writeCertificate(filepath.Join(*out, *name+".crt"), certBytes, ca.chain...); err != nil {
+		return fmt.Errorf("write %s cert: %w", *name, err)
 	}
-	if err = writePrivateKey(privKey, "target/ca.key"); err != nil {
-		return nil, fmt.Errorf("write ca key: %w", err)
+	if err = kf.writePrivateKey(privKey, filepath.Join(*out, *name+".key")); err != nil {
+		return fmt.Errorf("write %s key: %w", *name, err)
+	}
+	log.Printf("issued %s cert with serial %x\n", *cn, serial)
+	cert, err = x509.ParseCertificate(certBytes)
+	if err != nil {
+		return fmt.Errorf("parse %s cert: %w", *name, err)
 	}
-	return &rootCA{cert: cert, key: privKey}, nil
+	return recordCert(*out, *name, ca.name, cert)
 }
 
-func (r *rootCA) createCert(alias string, now time.Time) error {
-	log.Printf("generating %s cert\n", alias)
-	cert := &x509.Certificate{
-		SerialNumber: big.NewInt(2099),
-		Subject: pkix.Name{
-			CommonName:    fmt.Sprintf("%s.example.com", alias),
-			Country:       []string{"AU"},
-			Organization:  []string{"example grpc"},
-			Locality:      []string{"Brisbane"},
-			Province:      []string{"Queensland"},
-			StreetAddress: []string{"Adelaide Street"},
-			PostalCode:    []string{"4000"},
-		},
-		DNSNames:    []string{fmt.Sprintf("%s.example.com", alias), "localhost"},
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		NotBefore:   now,
-		NotAfter:    now.AddDate(0, 1, 0),
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-	}
-	privKey, err := newPrivateKey()
+// recordCert adds an issued certificate to the index.
+func recordCert(dir, name, issuerName string, cert *x509.Certificate) error {
+	idx, err := loadIndex(dir)
 	if err != nil {
-		return fmt.Errorf("generate %s pk: %w", alias, err)
+		return err
 	}
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, r.cert, publicKeyFor(privKey), r.key)
-	if err != nil {
-		return fmt.Errorf("generate %s cert: %w", alias, err)
+	issuerSerial := cert.SerialNumber
+	if !isSelfSigned(cert) {
+		issuer, err := readCertificates(filepath.Join(dir, issuerName+".crt"))
+		if err != nil {
+			return err
+		}
+		issuerSerial = issuer[0].SerialNumber
 	}
-	if err = writeCertificate(certBytes, fmt.Sprintf("target/%s.crt", alias)); err != nil {
-		return fmt.Errorf("write %s cert: %w", alias, err)
+	idx.add(&indexEntry{
+		Serial:       fmt.Sprintf("%x", cert.SerialNumber),
+		Name:         name,
+		CommonName:   cert.Subject.CommonName,
+		Subject:      cert.Subject.String(),
+		IsCA:         cert.IsCA,
+		Issuer:       issuerName,
+		IssuerSerial: fmt.Sprintf("%x", issuerSerial),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	})
+	return idx.save(dir)
+}
+
+func addSANs(cert *x509.Certificate, dnsSANs, ipSANs, uriSANs, emailSANs string) error {
+	cert.DNSNames = splitList(dnsSANs)
+	if len(cert.DNSNames) == 0 && !strings.Contains(cert.Subject.CommonName, " ") {
+		// clients ignore the common name when checking server certs
+		cert.DNSNames = []string{cert.Subject.CommonName}
+	}
+	for _, value := range splitList(ipSANs) {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address: %s", value)
+		}
+		cert.IPAddresses = append(cert.IPAddresses, ip)
 	}
-	if err = writePrivateKey(privKey, fmt.Sprintf("target/%s.key", alias)); err != nil {
-		return fmt.Errorf("write %s key: %w", alias, err)
+	for _, value := range splitList(uriSANs) {
+		uri, err := url.Parse(value)
+		if err != nil || uri.Scheme == "" {
+			return fmt.Errorf("invalid URI: %s", value)
+		}
+		cert.URIs = append(cert.URIs, uri)
 	}
+	cert.EmailAddresses = splitList(emailSANs)
 	return nil
 }
 
-func newPrivateKey() (any, error) {
-	if useElliptic {
-		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-		return priv, err
-	}
-	priv, err := rsa.GenerateKey(rand.Reader, 4096)
-	return priv, err
+type certAuthority struct {
+	name string
+	cert *x509.Certificate
+	key  crypto.Signer
+	// the CA's own cert followed by any intermediate CAs above it,
+	// which is empty for root CAs since clients already have them
+	chain [][]byte
 }
 
-func publicKeyFor(privKey any) any {
-	if useElliptic {
-		pk := privKey.(*ecdsa.PrivateKey)
-		return &pk.PublicKey
-	}
-	pk := privKey.(*rsa.PrivateKey)
-	return &pk.PublicKey
+func addCAPassphraseFlag(fs *flag.FlagSet) *string {
+	return fs.String("ca-passphrase-file", "", "passphrase file for an encrypted CA key (or env CA_KEY_PASSPHRASE)")
 }
 
-func writeCertificate(certBytes []byte, outfile string) error {
-	fp, err := os.Create(outfile)
+func loadCA(dir, name, passphraseFile string) (*certAuthority, error) {
+	passphrase, err := readPassphrase(passphraseFile, "CA_KEY_PASSPHRASE")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	pair, err := tlsconfig.LoadKeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"), passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load CA %s (run init-ca first?): %w", name, err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s CA key cannot sign certificates", name)
 	}
-	defer fp.Close()
+	if !pair.Leaf.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", name)
+	}
+	ca := &certAuthority{name: name, cert: pair.Leaf, key: signer}
+	if !isSelfSigned(pair.Leaf) {
+		ca.chain = pair.Certificate
+	}
+	return ca, nil
+}
 
-	return pem.Encode(fp, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certBytes,
-	})
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
 }
 
-func writePrivateKey(privKey any, outfile string) error {
-	fp, err := os.Create(outfile)
-	if err != nil {
-		return err
+func newSubject(cn, org string) pkix.Name {
+	name := pkix.Name{CommonName: cn}
+	if org != "" {
+		name.Organization = []string{org}
 	}
-	defer fp.Close()
+	return name
+}
 
-	if !useElliptic {
-		pk := privKey.(*rsa.PrivateKey)
-		return pem.Encode(fp, &pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(pk),
-		})
+// newSerial creates a random 128-bit serial number, so that serials
+// are unique without needing to remember which ones have been used.
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial: %w", err)
 	}
+	return serial, nil
+}
 
-	pk := privKey.(*ecdsa.PrivateKey)
-	buf, err := x509.MarshalECPrivateKey(pk)
-	if err != nil {
-		return err
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
 	}
-	return pem.Encode(fp, &pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: buf,
-	})
+	return res
 }
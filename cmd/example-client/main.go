@@ -2,29 +2,34 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"flag"
 	"fmt"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/tlsconfig"
 )
 
 var (
 	useToken = flag.String("token", "", "use this token for bearer authentication")
 	useAlice = flag.Bool("alice", false, "use Alice's certificate & key for TLS authentication")
 	useBob   = flag.Bool("bob", false, "use Bob's certificate & key for TLS authentication")
-	addr     = flag.String("addr", "localhost:8000", "server address")
+	addr     = flag.String("addr", "localhost:8000", "server address, or unix:///path/to/socket")
+	noTLS    = flag.Bool("plaintext", false, "connect without TLS, as the server does on unix sockets")
 	msg      = flag.String("msg", "", "message to send")
 )
 
+var tlsFlags = tlsconfig.RegisterFlags(flag.CommandLine, tlsconfig.Config{
+	CAFiles:    []string{"target/ca.crt"},
+	ServerName: "server.example.com",
+})
+
 func main() {
 	flag.Parse()
 	// Fatal logging prevents defer from firing, so wrap the
@@ -64,43 +69,29 @@ func realMain() error {
 }
 
 func newTransportCredentials() (credentials.TransportCredentials, error) {
-	if *useAlice || *useBob {
-		return newMTLSTransportCredentials()
+	if *noTLS {
+		return insecure.NewCredentials(), nil
 	}
-	return credentials.NewClientTLSFromFile("target/ca.crt", "server.example.com")
-}
-
-func newMTLSTransportCredentials() (credentials.TransportCredentials, error) {
-	// 1. Verify that the server's certificate was generated by our trusted CA.
-	caCert, err := os.ReadFile("target/ca.crt")
+	// 1. Verify that the server's certificate was generated by a trusted CA.
+	tlsCfg, err := tlsFlags.Config()
 	if err != nil {
-		return nil, fmt.Errorf("cannot read root CA cert: %w", err)
-	}
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to add root CA cert into cert pool")
+		return nil, err
 	}
 
 	// 2. Whose certificate & key should we use to authenticate with the server?
-	var certFile, keyFile string
 	if *useAlice {
-		certFile = "target/alice.crt"
-		keyFile = "target/alice.key"
+		tlsCfg.CertFile = "target/alice.crt"
+		tlsCfg.KeyFile = "target/alice.key"
 	}
 	if *useBob {
-		certFile = "target/bob.crt"
-		keyFile = "target/bob.key"
-	}
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load cert & key files: %w", err)
+		tlsCfg.CertFile = "target/bob.crt"
+		tlsCfg.KeyFile = "target/bob.key"
 	}
 
-	// 3. Configure mutual TLS authentication with the server.
-	cfg := &tls.Config{
-		RootCAs:      caCertPool,
-		Certificates: []tls.Certificate{cert},
-		ServerName:   "server.example.com",
+	// 3. Configure (mutual) TLS authentication with the server.
+	cfg, err := tlsCfg.Client()
+	if err != nil {
+		return nil, err
 	}
 	return credentials.NewTLS(cfg), nil
 }
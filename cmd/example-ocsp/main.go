@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/tomcz/example-grpc/tlsconfig"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:8888", "OCSP responder listen address")
+	caCert  = flag.String("ca-cert", "target/ca.crt", "issuing CA certificate")
+	caKey   = flag.String("ca-key", "target/ca.key", "issuing CA private key")
+	crlFile = flag.String("crl", "target/ca.crl", "CRL listing the revoked certificates")
+	idxFile = flag.String("index", "target/index.json", "example-certs index of the issued certificates")
+	maxAge  = flag.Duration("max-age", time.Hour, "how long clients may cache responses")
+)
+
+func main() {
+	flag.Parse()
+	// Fatal logging prevents defer from firing, so wrap the
+	// service configuration & startup in a realMain function.
+	if err := realMain(); err != nil {
+		log.WithError(err).Fatal("application failed")
+	}
+	log.Info("application stopped")
+}
+
+func realMain() error {
+	issuer, err := readCertificate(*caCert)
+	if err != nil {
+		return fmt.Errorf("cannot read CA cert: %w", err)
+	}
+	// encrypted CA keys need their passphrase in CA_KEY_PASSPHRASE
+	signer, err := tlsconfig.ReadPrivateKey(*caKey, []byte(os.Getenv("CA_KEY_PASSPHRASE")))
+	if err != nil {
+		return fmt.Errorf("cannot read CA key: %w", err)
+	}
+	r := &responder{issuer: issuer, signer: signer}
+	log.WithField("addr", *addr).Info("starting OCSP responder")
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	err = srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+type responder struct {
+	issuer *x509.Certificate
+	signer crypto.Signer
+}
+
+func (r *responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body []byte
+	var err error
+	switch req.Method {
+	case http.MethodPost:
+		body, err = io.ReadAll(io.LimitReader(req.Body, 1<<16))
+	case http.MethodGet:
+		body, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/"))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Bad OCSP request", http.StatusBadRequest)
+		return
+	}
+	res, err := r.respond(body)
+	if err != nil {
+		log.WithError(err).Warn("OCSP request failed")
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(ocsp.MalformedRequestErrorResponse)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	_, _ = w.Write(res)
+}
+
+func (r *responder) respond(body []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	ll := log.WithField("serial", req.SerialNumber)
+	ok, err := r.issued(req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// only answer for our own CA, and let clients look elsewhere for others
+		ll.Warn("OCSP request for another CA")
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+	// re-read the CRL & index on every request so that changes show up immediately
+	revoked, err := readRevoked(*crlFile, r.issuer)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := readIssued(*idxFile, r.issuer)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(*maxAge),
+	}
+	serial := fmt.Sprintf("%x", req.SerialNumber)
+	if at, ok := revoked[req.SerialNumber.String()]; ok {
+		tmpl.Status = ocsp.Revoked
+		tmpl.RevokedAt = at
+		tmpl.RevocationReason = ocsp.Unspecified
+	} else if !issued[serial] {
+		// never report certificates that the CA did not issue as good
+		tmpl.Status = ocsp.Unknown
+	}
+	ll.WithField("status", statusNames[tmpl.Status]).Info("OCSP request")
+	return ocsp.CreateResponse(r.issuer, r.issuer, tmpl, r.signer)
+}
+
+var statusNames = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// issued checks that the request is about a certificate issued by our CA.
+func (r *responder) issued(req *ocsp.Request) (bool, error) {
+	if !req.HashAlgorithm.Available() {
+		return false, fmt.Errorf("unsupported OCSP hash algorithm: %v", req.HashAlgorithm)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false, err
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(r.issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash), nil
+}
+
+func readRevoked(filename string, issuer *x509.Certificate) (map[string]time.Time, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(buf); block != nil {
+		buf = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err = crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]time.Time)
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = entry.RevocationTime
+	}
+	return revoked, nil
+}
+
+// readIssued returns the hex serial numbers of the certificates
+// that example-certs has recorded as issued by the CA.
+func readIssued(filename string, issuer *x509.Certificate) (map[string]bool, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var idx struct {
+		Certificates []struct {
+			Serial       string `json:"serial"`
+			IssuerSerial string `json:"issuer_serial"`
+		} `json:"certificates"`
+	}
+	if err = json.Unmarshal(buf, &idx); err != nil {
+		return nil, fmt.Errorf("cannot parse index: %w", err)
+	}
+	issuerSerial := fmt.Sprintf("%x", issuer.SerialNumber)
+	issued := make(map[string]bool)
+	for _, entry := range idx.Certificates {
+		if entry.IssuerSerial == issuerSerial && entry.Serial != issuerSerial {
+			issued[entry.Serial] = true
+		}
+	}
+	return issued, nil
+}
+
+func readCertificate(filename string) (*x509.Certificate, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -2,28 +2,83 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/tomcz/gotools/errgroup"
-	"github.com/tomcz/gotools/quiet"
 
+	"github.com/tomcz/example-grpc/api"
 	"github.com/tomcz/example-grpc/server"
 	"github.com/tomcz/example-grpc/server/echo"
 	"github.com/tomcz/example-grpc/server/grpcx"
 	"github.com/tomcz/example-grpc/server/httpx"
+	"github.com/tomcz/example-grpc/server/issuer"
+	"github.com/tomcz/example-grpc/server/metrics"
+	"github.com/tomcz/example-grpc/tlsconfig"
 )
 
 var (
-	grpcPort = flag.Int("grpc", 8000, "gRPC listener port")
-	httpPort = flag.Int("http", 8443, "HTTP listener port")
-	tokens   = flag.String("tokens", "", "valid bearer tokens")
-	domains  = flag.String("domains", "", "valid client TLS certificate domains")
+	grpcAddr  = flag.String("grpc", "8000", "comma-separated gRPC listener ports, addresses, unix:///path/to/socket or systemd://name")
+	httpAddr  = flag.String("http", "8443", "comma-separated HTTP listener ports, addresses, unix:///path/to/socket or systemd://name")
+	onePort   = flag.Bool("single-port", false, "serve gRPC on the HTTP listener port, instead of its own port")
+	backend   = flag.String("backend", "", "only serve HTTP, by forwarding requests to this gRPC server address")
+	backCert  = flag.String("backend-cert", "target/gateway.crt", "client certificate for the gRPC backend")
+	backKey   = flag.String("backend-key", "target/gateway.key", "client private key for the gRPC backend")
+	backCA    = flag.String("backend-ca", "target/ca.crt", "comma-separated CA files that verify the gRPC backend")
+	backName  = flag.String("backend-server-name", "server.example.com", "expected name in the gRPC backend's certificate")
+	peers     = flag.String("peer-users", "", "comma-separated local users or uids that may authenticate on unix sockets by their peer credentials")
+	proxies   = flag.String("proxy-domains", "", "client TLS certificate domains of HTTP gateways trusted to forward caller identities")
+	tokens    = flag.String("tokens", "", "valid bearer tokens")
+	tokenDB   = flag.String("token-file", "", "YAML or JSON file of valid bearer token hashes")
+	domains   = flag.String("domains", "", "valid client TLS certificate domains")
+	certRule  = flag.String("cert-rules", "", "YAML or JSON client certificate rules, instead of -domains")
+	certPins  = flag.String("cert-pins", "", "file of pinned client certificate fingerprints")
+	mtlsMode  = flag.String("client-auth", "optional", "client certificate authentication: off, optional or required")
+	crls      = flag.String("crl", "", "comma-separated CRL files used to reject revoked client certificates")
+	crlTTL    = flag.Duration("crl-refresh", time.Hour, "CRL refresh interval")
+	crlInter  = flag.String("crl-intermediates", "", "comma-separated intermediate CA certificate files, whose CRLs are also given to -crl")
+	useOCSP   = flag.Bool("ocsp", false, "check client certificates with their OCSP responder")
+	ocspURL   = flag.String("ocsp-url", "", "OCSP responder URL, instead of the one in client certificates")
+	ocspHard  = flag.Bool("ocsp-hard-fail", false, "reject client certificates when OCSP checks fail")
+	policy    = flag.String("policy", "", "YAML or JSON authorization policy file")
+	reqRoles  = flag.Bool("proto-roles", false, "enforce the required roles declared on API methods in api/*.proto")
+	jwtKey    = flag.String("jwt-key", "", "validate bearer tokens as JWTs using this secret or public key file")
+	jwtJWKS   = flag.String("jwt-jwks", "", "validate bearer tokens as JWTs using this JWKS file or URL")
+	jwtTTL    = flag.Duration("jwt-jwks-refresh", 15*time.Minute, "JWKS refresh interval")
+	jwtAlg    = flag.String("jwt-alg", "RS256", "comma-separated JWT signing algorithms (HS256, RS256, ES256)")
+	jwtIss    = flag.String("jwt-issuer", "", "required JWT issuer")
+	jwtAud    = flag.String("jwt-audience", "", "required JWT audience")
+	jwtClaim  = flag.String("jwt-claim", "sub", "JWT claim that holds the username")
+	jwtRoles  = flag.String("jwt-roles-claim", "roles", "JWT claim that holds the user's roles")
+	varsAddr  = flag.String("metrics", "", "comma-separated metrics listener addresses (e.g. 10.0.0.1:9090)")
+	stopTTL   = flag.Duration("shutdown-timeout", 5*time.Second, "how long to wait for in-flight requests when shutting down")
+	adminPort = flag.Int("admin", 0, "admin listener port for metrics, which only listens on loopback addresses")
+	expWarn   = flag.Duration("expiry-warn", 14*24*time.Hour, "warn when server or CA certificates expire within this duration")
+	expCrit   = flag.Duration("expiry-critical", 7*24*time.Hour, "complain loudly when server or CA certificates expire within this duration")
+	expCheck  = flag.Duration("expiry-check", time.Hour, "certificate expiry check interval (0 to only check at startup)")
+	expUser   = flag.Duration("client-expiry-warn", 0, "warn when client certificates expire within this duration (0 to disable)")
+	issuePol  = flag.String("issuer-policy", "", "YAML or JSON certificate name policy, which enables the certificate issuer")
+	issueCrt  = flag.String("issuer-cert", "", "certificate issuer's CA certificate, which must not be trusted for client certificates")
+	issueKey  = flag.String("issuer-key", "", "certificate issuer's CA private key")
+	issuePwd  = flag.String("issuer-passphrase-file", "", "passphrase file for an encrypted issuer key (or env ISSUER_KEY_PASSPHRASE)")
+	issueTTL  = flag.Duration("issuer-max-validity", 24*time.Hour, "maximum lifetime of issued certificates")
 )
 
+var tlsFlags = tlsconfig.RegisterFlags(flag.CommandLine, tlsconfig.Config{
+	CAFiles:  []string{"target/ca.crt"},
+	CertFile: "target/server.crt",
+	KeyFile:  "target/server.key",
+})
+
 func main() {
 	flag.Parse()
 	// Fatal logging prevents defer from firing, so wrap the
@@ -38,43 +93,274 @@ func realMain() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	tlsCfg, err := tlsFlags.Config()
+	if err != nil {
+		return err
+	}
+
 	impl := echo.NewExampleServer()
-	auth := server.NewBearerAuth(*tokens)
-	mtls := server.NewDomainAllowList(*domains)
+	checkers, err := newRevocationCheckers(ctx, tlsCfg)
+	if err != nil {
+		return err
+	}
+	mtls, err := newAllowList(checkers)
+	if err != nil {
+		return err
+	}
+	auth, err := newTokenAuth(ctx)
+	if err != nil {
+		return err
+	}
+	policyAuthz, err := server.LoadPolicy(*policy)
+	if err != nil {
+		return err
+	}
+	clientAuth, err := server.ParseClientAuthMode(*mtlsMode)
+	if err != nil {
+		return err
+	}
+	peerUsers, err := server.NewPeerAllowList(*peers)
+	if err != nil {
+		return err
+	}
+	sa := server.Auth{
+		Tokens:     auth,
+		AllowList:  mtls,
+		Authorizer: policyAuthz,
+		ClientAuth: clientAuth,
+		Proxies:    withRevocation(server.NewDomainAllowList(*proxies), checkers),
+		Peers:      peerUsers,
+		ProtoRoles: *reqRoles,
+	}
 
-	grpcSrv, err := grpcx.NewService(impl, *grpcPort, auth, mtls)
+	if err = sa.Validate(); err != nil {
+		return err
+	}
+	certs, err := tlsconfig.NewReloader(ctx, tlsCfg, sa.MTLS().TLSClientAuth())
+	if err != nil {
+		return err
+	}
+	tlsconfig.MonitorExpiry(ctx, certs, tlsconfig.ExpiryThresholds{Warn: *expWarn, Critical: *expCrit}, *expCheck)
+	certIssuer, err := newIssuer(certs.CACerts())
 	if err != nil {
 		return err
 	}
-	httpSrv, err := httpx.NewService(ctx, impl, *httpPort, auth, mtls)
+
+	services, err := newServices(ctx, impl, certIssuer, sa, certs)
 	if err != nil {
 		return err
 	}
 
-	shutdown := new(quiet.Closer)
-	shutdown.AddFunc(grpcSrv.GracefulStop)
-	shutdown.AddFunc(httpSrv.GracefulStop)
+	adminAddrs := splitList(*varsAddr)
+	if *adminPort > 0 {
+		adminAddrs = append(adminAddrs, fmt.Sprintf("loopback:%d", *adminPort))
+	}
+	if len(adminAddrs) > 0 {
+		services = append(services, metrics.NewService(adminAddrs))
+	}
 
 	group := errgroup.New()
+	for _, srv := range services {
+		group.Go(func() error {
+			defer cancel()
+			return srv.ListenAndServe()
+		})
+	}
 	group.Go(func() error {
-		defer cancel()
-		return grpcSrv.ListenAndServe()
-	})
-	group.Go(func() error {
-		defer cancel()
-		return httpSrv.ListenAndServe()
+		for _, srv := range services {
+			select {
+			case <-srv.Ready():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		log.Info("application ready")
+		return nil
 	})
 	group.Go(func() error {
-		defer shutdown.CloseAll()
 		signalChan := make(chan os.Signal, 1)
 		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 		select {
 		case <-signalChan:
 			log.Info("shutdown received")
-			return nil
 		case <-ctx.Done():
-			return nil
 		}
+		return shutdown(services)
 	})
 	return group.Wait()
 }
+
+// shutdown stops all services at the same time, so that they share the timeout.
+func shutdown(services []server.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *stopTTL)
+	defer cancel()
+
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i, srv := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				errs[i] = fmt.Errorf("shutdown failed: %w", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func newServices(ctx context.Context, impl api.ExampleServer, certIssuer api.IssuerServer, sa server.Auth, certs *tlsconfig.Reloader) ([]server.Service, error) {
+	if *backend != "" {
+		if *onePort {
+			return nil, fmt.Errorf("cannot forward HTTP requests to a backend in single-port mode")
+		}
+		backendCfg := tlsconfig.Config{
+			CAFiles:    strings.Split(*backCA, ","),
+			CertFile:   *backCert,
+			KeyFile:    *backKey,
+			ServerName: *backName,
+		}
+		backendTLS, err := backendCfg.Client()
+		if err != nil {
+			return nil, err
+		}
+		httpSrv, err := httpx.NewProxyService(ctx, httpx.Backend{Addr: *backend, TLS: backendTLS}, splitList(*httpAddr), sa, certs)
+		if err != nil {
+			return nil, err
+		}
+		return []server.Service{httpSrv}, nil
+	}
+	if *onePort {
+		httpSrv, err := httpx.NewSinglePortService(ctx, impl, certIssuer, splitList(*httpAddr), sa, certs)
+		if err != nil {
+			return nil, err
+		}
+		return []server.Service{httpSrv}, nil
+	}
+	grpcSrv, err := grpcx.NewService(impl, certIssuer, splitList(*grpcAddr), sa, certs)
+	if err != nil {
+		return nil, err
+	}
+	httpSrv, err := httpx.NewService(ctx, impl, certIssuer, splitList(*httpAddr), sa, certs)
+	if err != nil {
+		return nil, err
+	}
+	return []server.Service{grpcSrv, httpSrv}, nil
+}
+
+func newAllowList(checkers []server.RevocationChecker) (server.AllowList, error) {
+	mtls := server.NewDomainAllowList(*domains)
+	if *certRule != "" {
+		var err error
+		mtls, err = server.NewRuleAllowList(*certRule)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *certPins != "" {
+		pins, err := server.NewPinnedAllowList(*certPins)
+		if err != nil {
+			return nil, err
+		}
+		// pinned certs are checked first as they are the most specific
+		mtls = server.NewAnyAllowList(pins, mtls)
+	}
+	mtls = server.NewExpiryWarningAllowList(mtls, *expUser)
+	return withRevocation(mtls, checkers), nil
+}
+
+func newRevocationCheckers(ctx context.Context, tlsCfg tlsconfig.Config) ([]server.RevocationChecker, error) {
+	var checkers []server.RevocationChecker
+	if (*crls != "" || *useOCSP) && len(tlsCfg.CAFiles) == 0 {
+		return nil, fmt.Errorf("revocation checks need a CA file")
+	}
+	if *crls != "" {
+		checker, err := server.NewCRLChecker(ctx, tlsCfg.CAFiles[0], splitList(*crlInter), strings.Split(*crls, ","), *crlTTL)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+	if *useOCSP {
+		checker, err := server.NewOCSPChecker(tlsCfg.CAFiles[0], *ocspURL, *ocspHard, nil)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+	return checkers, nil
+}
+
+// withRevocation applies the revocation checks to every certificate that
+// the allow list accepts, including those of trusted gateways.
+func withRevocation(list server.AllowList, checkers []server.RevocationChecker) server.AllowList {
+	if len(checkers) == 0 {
+		return list
+	}
+	return server.NewRevocationAllowList(list, checkers...)
+}
+
+func newIssuer(clientCAs []*x509.Certificate) (api.IssuerServer, error) {
+	if *issuePol == "" {
+		return nil, nil
+	}
+	if *issueCrt == "" || *issueKey == "" {
+		return nil, fmt.Errorf("the certificate issuer needs -issuer-cert and -issuer-key")
+	}
+	policy, err := issuer.LoadNamePolicy(*issuePol)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := []byte(os.Getenv("ISSUER_KEY_PASSPHRASE"))
+	if *issuePwd != "" {
+		if passphrase, err = tlsconfig.ReadPassphrase(*issuePwd); err != nil {
+			return nil, err
+		}
+	}
+	return issuer.NewIssuerServer(issuer.Config{
+		CertFile:    *issueCrt,
+		KeyFile:     *issueKey,
+		Passphrase:  passphrase,
+		MaxValidity: *issueTTL,
+		Policy:      policy,
+		ClientCAs:   clientCAs,
+	})
+}
+
+func newTokenAuth(ctx context.Context) (server.TokenAuth, error) {
+	if *tokenDB != "" {
+		return server.NewFileTokenAuth(ctx, *tokenDB)
+	}
+	if *jwtKey == "" && *jwtJWKS == "" {
+		return server.NewBearerAuth(*tokens), nil
+	}
+	cfg := server.JWTConfig{
+		Algorithms:    strings.Split(*jwtAlg, ","),
+		Issuer:        *jwtIss,
+		Audience:      *jwtAud,
+		UsernameClaim: *jwtClaim,
+		RolesClaim:    *jwtRoles,
+		Leeway:        time.Minute,
+	}
+	var err error
+	if *jwtJWKS != "" {
+		cfg.Keys, err = server.NewJWKS(ctx, *jwtJWKS, *jwtTTL, nil)
+	} else {
+		cfg.Key, err = server.LoadJWTKey(cfg.Algorithms[0], *jwtKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return server.NewJWTAuth(cfg)
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+const usage = `usage: example-tokens <command> [flags]
+
+commands:
+  generate  create a random token and its hash
+  hash      hash a secret read from stdin (e.g. a passphrase)
+
+Run "example-tokens <command> -h" for command flags.
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generateCmd(os.Args[2:])
+	case "hash":
+		err = hashCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+type entryFlags struct {
+	user    *string
+	roles   *string
+	expires *time.Duration
+}
+
+func addEntryFlags(fs *flag.FlagSet) entryFlags {
+	return entryFlags{
+		user:    fs.String("user", "", "username for the token (required)"),
+		roles:   fs.String("roles", "", "comma-separated roles granted to the token"),
+		expires: fs.Duration("expires", 0, "token lifetime, or zero for no expiry"),
+	}
+}
+
+func generateCmd(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	ef := addEntryFlags(fs)
+	alg := fs.String("alg", server.HashSHA256, "hash algorithm (sha256, bcrypt or argon2id)")
+	_ = fs.Parse(args)
+
+	id, token, err := server.NewToken()
+	if err != nil {
+		return err
+	}
+	_, secret, _ := server.SplitToken(token)
+	return printEntry(ef, *alg, id, token, secret)
+}
+
+func hashCmd(args []string) error {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	ef := addEntryFlags(fs)
+	alg := fs.String("alg", server.HashArgon2id, "hash algorithm (sha256, bcrypt or argon2id)")
+	_ = fs.Parse(args)
+
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return fmt.Errorf("no secret provided on stdin: %w", err)
+	}
+	// secrets still need an ID prefix so that we can find their hash
+	idBuf := make([]byte, 8)
+	if _, err = rand.Read(idBuf); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(idBuf)
+	return printEntry(ef, *alg, id, id+"."+secret, secret)
+}
+
+func printEntry(ef entryFlags, alg, id, token, secret string) error {
+	if *ef.user == "" {
+		return fmt.Errorf("-user is required")
+	}
+	hash, err := server.HashToken(alg, secret)
+	if err != nil {
+		return err
+	}
+	entry := server.TokenEntry{
+		User:      *ef.user,
+		ID:        id,
+		TokenHash: hash,
+	}
+	if *ef.roles != "" {
+		entry.Roles = strings.Split(*ef.roles, ",")
+	}
+	if *ef.expires > 0 {
+		entry.Expires = time.Now().Add(*ef.expires).UTC().Truncate(time.Second)
+	}
+	// the token goes to stderr so that stdout can be redirected to a token file
+	fmt.Fprintf(os.Stderr, "token for %s (it cannot be recovered from the hash): %s\n", entry.User, token)
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err = enc.Encode(map[string][]server.TokenEntry{"tokens": {entry}}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,66 @@
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/tomcz/gotools/maps/sets"
+)
+
+// give editors & config management a moment to finish writing
+const watchSettleTime = 250 * time.Millisecond
+
+// Files calls onChange whenever any of the files are written, created or
+// replaced, until the context is cancelled. Parent directories are watched, rather
+// than the files themselves, so that files replaced by a rename are not lost.
+func Files(ctx context.Context, onChange func(), filenames ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot create file watcher: %w", err)
+	}
+	files := sets.NewSet[string]()
+	for _, filename := range filenames {
+		var abs string
+		abs, err = filepath.Abs(filename)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		sets.Add(files, abs)
+		dir := filepath.Dir(abs)
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+	}
+	go func() {
+		defer watcher.Close()
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if sets.Contains(files, filepath.Clean(event.Name)) && !event.Has(fsnotify.Chmod) {
+					settle = time.After(watchSettleTime)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Warn("file watcher failed")
+			case <-settle:
+				settle = nil
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
-	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -16,82 +18,110 @@ var ErrInvalidToken = errors.New("invalid token")
 // ErrNoCertMatch authentication failure
 var ErrNoCertMatch = errors.New("no certificate match")
 
-type contextKey int
-
-const (
-	usernameKey contextKey = iota
-)
-
-// WithUserName store the username under a well-known context key
-func WithUserName(ctx context.Context, username string) context.Context {
-	return context.WithValue(ctx, usernameKey, username)
-}
-
-// UserName retrieves the existing username, or returns an empty string
-func UserName(ctx context.Context) string {
-	if username, ok := ctx.Value(usernameKey).(string); ok {
-		return username
-	}
-	return ""
-}
-
 // TokenAuth represents a way of resolving tokens to usernames.
 type TokenAuth interface {
-	Authenticate(token string) (username string, err error)
+	Authenticate(token string) (*Principal, error)
 	Scheme() string
 }
 
-type bearerAuth map[string]string
+type bearerToken struct {
+	digest   [sha256.Size]byte
+	username string
+}
+
+// only keep token digests, so that plaintext tokens
+// are not kept around and can be compared in constant time
+type bearerAuth []bearerToken
 
 // NewBearerAuth represents bearer token authentication.
 func NewBearerAuth(tokens string) TokenAuth {
-	tokenMap := make(map[string]string)
+	var auth bearerAuth
 	for _, tok := range strings.Split(tokens, ",") {
 		pair := strings.SplitN(tok, ":", 2)
 		if len(pair) == 2 {
-			tokenMap[pair[1]] = pair[0]
+			auth = append(auth, bearerToken{
+				digest:   sha256.Sum256([]byte(pair[1])),
+				username: pair[0],
+			})
 		}
 	}
-	return bearerAuth(tokenMap)
+	return auth
 }
 
 func (b bearerAuth) Scheme() string {
 	return "bearer"
 }
 
-func (b bearerAuth) Authenticate(token string) (string, error) {
-	if username, ok := b[token]; ok {
-		return username, nil
+func (b bearerAuth) Authenticate(token string) (*Principal, error) {
+	digest := sha256.Sum256([]byte(token))
+	username := ""
+	// check every token so that timing does not reveal which one matched
+	for _, tok := range b {
+		if subtle.ConstantTimeCompare(digest[:], tok.digest[:]) == 1 {
+			username = tok.username
+		}
 	}
-	return "", ErrInvalidToken
+	if username != "" {
+		return &Principal{Name: username, Method: AuthMethodToken}, nil
+	}
+	return nil, ErrInvalidToken
 }
 
 // AllowList describes a list of allowed TLS certificates.
 type AllowList interface {
-	Allow(cert *x509.Certificate) (username string, err error)
+	Allow(cert *x509.Certificate) (*Principal, error)
 	Enabled() bool
 }
 
+// ChainAllowList is implemented by allow lists that need to see the
+// client's verified certificate chain, and not just its own certificate.
+type ChainAllowList interface {
+	AllowChain(chain []*x509.Certificate) (*Principal, error)
+}
+
+// AllowChain checks a client certificate chain, leaf first, against the allow list.
+func AllowChain(list AllowList, chain []*x509.Certificate) (*Principal, error) {
+	if cl, ok := list.(ChainAllowList); ok {
+		return cl.AllowChain(chain)
+	}
+	return list.Allow(chain[0])
+}
+
+// ClientChain returns the client's certificate chain from a TLS connection,
+// preferring the chain verified during the handshake to the one that was sent.
+func ClientChain(state tls.ConnectionState) []*x509.Certificate {
+	if len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains[0]
+	}
+	return state.PeerCertificates
+}
+
 type domainAllowList map[string]bool
 
 // NewDomainAllowList creates an allowed list from a comma-separated set of domains.
+// Blank entries are ignored, so an empty set of domains creates a disabled
+// allow list rather than one that accepts certificates without a CN.
 func NewDomainAllowList(domainsCSV string) AllowList {
-	domains := strings.Split(domainsCSV, ",")
-	return domainAllowList(sets.NewSet(domains...))
+	domains := sets.NewSet[string]()
+	for _, domain := range strings.Split(domainsCSV, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			sets.Add(domains, domain)
+		}
+	}
+	return domainAllowList(domains)
 }
 
-func (d domainAllowList) Allow(cert *x509.Certificate) (username string, err error) {
-	// MAYBE: fail if the certificate has been revoked by the issuer
+func (d domainAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
 	cn := cert.Subject.CommonName
 	if sets.Contains(d, cn) {
-		return cn, nil
+		return NewCertPrincipal(cn, cert), nil
 	}
 	for _, san := range cert.DNSNames {
 		if sets.Contains(d, san) {
-			return san, nil
+			return NewCertPrincipal(san, cert), nil
 		}
 	}
-	return "", fmt.Errorf("%w - CN: %s", ErrNoCertMatch, cn)
+	return nil, fmt.Errorf("%w - CN: %s", ErrNoCertMatch, cn)
 }
 
 func (d domainAllowList) Enabled() bool {
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+)
+
+func TestDomainAllowList(t *testing.T) {
+	noCN := &x509.Certificate{}
+	alice := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "alice"},
+		DNSNames: []string{"alice.example.com"},
+	}
+	tests := []struct {
+		name    string
+		domains string
+		enabled bool
+		cert    *x509.Certificate
+		want    string
+	}{
+		{name: "empty", domains: "", enabled: false, cert: noCN},
+		{name: "blank entries", domains: " , ,", enabled: false, cert: noCN},
+		{name: "trailing comma", domains: "bob.example.com,", enabled: true, cert: noCN},
+		{name: "common name", domains: "alice", enabled: true, cert: alice, want: "alice"},
+		{name: "dns san", domains: "bob.example.com, alice.example.com", enabled: true, cert: alice, want: "alice.example.com"},
+		{name: "no match", domains: "bob.example.com", enabled: true, cert: alice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewDomainAllowList(tt.domains)
+			if list.Enabled() != tt.enabled {
+				t.Fatalf("enabled: got %v, want %v", list.Enabled(), tt.enabled)
+			}
+			p, err := list.Allow(tt.cert)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoCertMatch) {
+					t.Fatalf("expected ErrNoCertMatch, got principal %v, error %v", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != tt.want {
+				t.Fatalf("got %s, want %s", p.Name, tt.want)
+			}
+		})
+	}
+}
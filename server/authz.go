@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrAccessDenied authorization failure
+var ErrAccessDenied = errors.New("access denied")
+
+// Authorizer decides whether a principal may access a resource, which is
+// either a full gRPC method name (e.g. "/example.service.Example/Echo")
+// or an HTTP method and path (e.g. "POST /v1/example/echo").
+type Authorizer interface {
+	Authorize(principal *Principal, resource string) error
+	Enabled() bool
+}
+
+// Policy is a declarative set of authorization rules.
+type Policy struct {
+	// DefaultAllow decides access to resources that have no matching rules.
+	DefaultAllow bool         `yaml:"default_allow"`
+	Rules        []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule grants access to resources matching any of its glob patterns.
+// A user of "*" grants access to every authenticated principal.
+type PolicyRule struct {
+	Resources []string `yaml:"resources"`
+	Users     []string `yaml:"users"`
+	Roles     []string `yaml:"roles"`
+}
+
+// LoadPolicy reads a YAML or JSON policy file. No file means no authorization checks.
+func LoadPolicy(policyFile string) (Authorizer, error) {
+	if policyFile == "" {
+		return &Policy{DefaultAllow: true}, nil
+	}
+	buf, err := os.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+	policy := &Policy{}
+	if err = yaml.Unmarshal(buf, policy); err != nil {
+		return nil, fmt.Errorf("cannot parse policy file: %w", err)
+	}
+	for _, rule := range policy.Rules {
+		for _, pattern := range rule.Resources {
+			if _, err = path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("bad resource pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+func (p *Policy) Enabled() bool {
+	return len(p.Rules) > 0 || !p.DefaultAllow
+}
+
+func (p *Policy) Authorize(principal *Principal, resource string) error {
+	matched := false
+	for _, rule := range p.Rules {
+		if !rule.matches(resource) {
+			continue
+		}
+		matched = true
+		if rule.allows(principal) {
+			return nil
+		}
+	}
+	if !matched && p.DefaultAllow {
+		return nil
+	}
+	name := ""
+	if principal != nil {
+		name = principal.Name
+	}
+	return fmt.Errorf("%w - user: %q, resource: %q", ErrAccessDenied, name, resource)
+}
+
+func (r PolicyRule) matches(resource string) bool {
+	for _, pattern := range r.Resources {
+		if ok, _ := path.Match(pattern, resource); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) allows(principal *Principal) bool {
+	if principal == nil {
+		return false
+	}
+	if slices.Contains(r.Users, "*") || slices.Contains(r.Users, principal.Name) {
+		return true
+	}
+	for _, role := range r.Roles {
+		if principal.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+type authorizerChain []Authorizer
+
+// NewAuthorizerChain combines authorizers so that access is only
+// granted when every enabled authorizer in the chain allows it.
+func NewAuthorizerChain(authorizers ...Authorizer) Authorizer {
+	var chain authorizerChain
+	for _, authz := range authorizers {
+		if authz.Enabled() {
+			chain = append(chain, authz)
+		}
+	}
+	return chain
+}
+
+func (c authorizerChain) Enabled() bool {
+	return len(c) > 0
+}
+
+func (c authorizerChain) Authorize(principal *Principal, resource string) error {
+	for _, authz := range c {
+		if err := authz.Authorize(principal, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"crypto/x509"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type expiryAllowList struct {
+	next   AllowList
+	within time.Duration
+}
+
+// NewExpiryWarningAllowList logs a warning when an allowed client certificate
+// expires within the given duration, so that its owner can be nagged to renew it.
+func NewExpiryWarningAllowList(next AllowList, within time.Duration) AllowList {
+	if within <= 0 {
+		return next
+	}
+	return &expiryAllowList{next: next, within: within}
+}
+
+func (e *expiryAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
+	return e.AllowChain([]*x509.Certificate{cert})
+}
+
+func (e *expiryAllowList) AllowChain(chain []*x509.Certificate) (*Principal, error) {
+	principal, err := AllowChain(e.next, chain)
+	if err != nil {
+		return nil, err
+	}
+	cert := chain[0]
+	if remaining := time.Until(cert.NotAfter); remaining <= e.within {
+		log.WithField("user", principal.Name).
+			WithField("serial", cert.SerialNumber).
+			WithField("not_after", cert.NotAfter).
+			WithField("remaining", remaining.Round(time.Minute)).
+			Warn("client certificate expires soon")
+	}
+	return principal, nil
+}
+
+func (e *expiryAllowList) Enabled() bool {
+	return e.next.Enabled()
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Certificate fields that a CertRule can take a username from.
+const (
+	UsernameFromCN    = "cn"
+	UsernameFromDNS   = "dns"
+	UsernameFromURI   = "uri"
+	UsernameFromEmail = "email"
+)
+
+// CertRule matches client certificates. Every non-empty pattern list must have
+// at least one pattern that matches the corresponding certificate field, and
+// a rule must have at least one pattern list.
+type CertRule struct {
+	// URISANs are glob patterns, such as "spiffe://example.org/ns/*/sa/*".
+	URISANs []string `yaml:"uri_sans"`
+	// EmailSANs are glob patterns, such as "*@example.com".
+	EmailSANs []string `yaml:"email_sans"`
+	// DNSNames are exact names or wildcards, such as "*.example.com",
+	// where the wildcard only matches a single DNS label.
+	DNSNames []string `yaml:"dns_names"`
+	// Organizations & OrganizationalUnits are glob patterns for the subject's O & OU.
+	Organizations       []string `yaml:"organizations"`
+	OrganizationalUnits []string `yaml:"organizational_units"`
+	// Issuers are glob patterns for the issuer's common name.
+	Issuers []string `yaml:"issuers"`
+	// Username is the certificate field that names the caller: "cn" (default),
+	// "dns", "uri" or "email". SAN fields use the first matching value.
+	Username string `yaml:"username"`
+	// Roles are granted to callers that match this rule.
+	Roles []string `yaml:"roles"`
+}
+
+type ruleAllowList []CertRule
+
+// NewRuleAllowList creates an allow list from a YAML or JSON file of rules.
+// Rules are checked in order and the first matching rule wins.
+func NewRuleAllowList(rulesFile string) (AllowList, error) {
+	buf, err := os.ReadFile(rulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cert rules: %w", err)
+	}
+	var file struct {
+		Rules []CertRule `yaml:"rules"`
+	}
+	if err = yaml.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse cert rules: %w", err)
+	}
+	if len(file.Rules) == 0 {
+		return nil, fmt.Errorf("no cert rules in %s", rulesFile)
+	}
+	for i, rule := range file.Rules {
+		if rule.empty() {
+			// a rule without any patterns would match every client certificate
+			return nil, fmt.Errorf("rule %d: no patterns to match", i)
+		}
+		switch rule.Username {
+		case "", UsernameFromCN, UsernameFromDNS, UsernameFromURI, UsernameFromEmail:
+		default:
+			return nil, fmt.Errorf("rule %d: unsupported username field %q", i, rule.Username)
+		}
+		for _, patterns := range [][]string{rule.URISANs, rule.EmailSANs, rule.Organizations, rule.OrganizationalUnits, rule.Issuers} {
+			for _, pattern := range patterns {
+				if _, err = path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("rule %d: bad pattern %q: %w", i, pattern, err)
+				}
+			}
+		}
+	}
+	return ruleAllowList(file.Rules), nil
+}
+
+func (r ruleAllowList) Enabled() bool {
+	return len(r) > 0
+}
+
+func (r ruleAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
+	for _, rule := range r {
+		if principal, ok := rule.match(cert); ok {
+			return principal, nil
+		}
+	}
+	return nil, fmt.Errorf("%w - CN: %s", ErrNoCertMatch, cert.Subject.CommonName)
+}
+
+func (c CertRule) empty() bool {
+	return len(c.URISANs) == 0 && len(c.EmailSANs) == 0 && len(c.DNSNames) == 0 &&
+		len(c.Organizations) == 0 && len(c.OrganizationalUnits) == 0 && len(c.Issuers) == 0
+}
+
+func (c CertRule) match(cert *x509.Certificate) (*Principal, bool) {
+	var uris []string
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	matchedURI, ok := firstMatch(c.URISANs, uris, globMatch)
+	if !ok {
+		return nil, false
+	}
+	matchedEmail, ok := firstMatch(c.EmailSANs, cert.EmailAddresses, globMatch)
+	if !ok {
+		return nil, false
+	}
+	matchedDNS, ok := firstMatch(c.DNSNames, cert.DNSNames, dnsMatch)
+	if !ok {
+		return nil, false
+	}
+	if _, ok = firstMatch(c.Organizations, cert.Subject.Organization, globMatch); !ok {
+		return nil, false
+	}
+	if _, ok = firstMatch(c.OrganizationalUnits, cert.Subject.OrganizationalUnit, globMatch); !ok {
+		return nil, false
+	}
+	if _, ok = firstMatch(c.Issuers, []string{cert.Issuer.CommonName}, globMatch); !ok {
+		return nil, false
+	}
+	var name string
+	switch c.Username {
+	case UsernameFromDNS:
+		name = matchedDNS
+	case UsernameFromURI:
+		name = matchedURI
+	case UsernameFromEmail:
+		name = matchedEmail
+	default:
+		name = cert.Subject.CommonName
+	}
+	if name == "" {
+		return nil, false
+	}
+	principal := NewCertPrincipal(name, cert)
+	principal.Roles = c.Roles
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			principal.Attributes["spiffe_id"] = uri.String()
+			break
+		}
+	}
+	return principal, true
+}
+
+// firstMatch returns the first value that matches any of the patterns, or the
+// first value when there are no patterns since an empty list means "don't care".
+func firstMatch(patterns, values []string, matches func(pattern, value string) bool) (string, bool) {
+	if len(patterns) == 0 {
+		if len(values) > 0 {
+			return values[0], true
+		}
+		return "", true
+	}
+	for _, value := range values {
+		for _, pattern := range patterns {
+			if matches(pattern, value) {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func globMatch(pattern, value string) bool {
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// dnsMatch follows RFC 6125 in only allowing a wildcard to be the whole left-most label.
+// Wildcards are only allowed in patterns, so a certificate for "*.example.com" does not
+// stand in for every name that "*.example.com" would match.
+func dnsMatch(pattern, name string) bool {
+	if strings.Contains(name, "*") {
+		return false
+	}
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, found := strings.Cut(name, ".")
+		return found && label != "" && rest == suffix
+	}
+	return pattern == name
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewRuleAllowListRejectsMatchAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{name: "empty file", rules: "", err: "no cert rules"},
+		{name: "no rules", rules: "rules: []", err: "no cert rules"},
+		{name: "username only", rules: "rules:\n  - username: cn\n", err: "rule 0: no patterns"},
+		{name: "roles only", rules: "rules:\n  - dns_names: [\"a.example.com\"]\n  - roles: [\"admin\"]\n", err: "rule 1: no patterns"},
+		{name: "empty patterns", rules: "rules:\n  - issuers: []\n", err: "rule 0: no patterns"},
+		{name: "valid", rules: "rules:\n  - issuers: [\"example root ca\"]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(file, []byte(tt.rules), 0600); err != nil {
+				t.Fatal(err)
+			}
+			list, err := NewRuleAllowList(file)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !list.Enabled() {
+					t.Fatal("expected an enabled allow list")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDNSMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "a.example.com", name: "a.example.com", want: true},
+		{pattern: "a.example.com", name: "A.Example.COM", want: true},
+		{pattern: "a.example.com.", name: "a.example.com", want: true},
+		{pattern: "a.example.com", name: "a.example.com.", want: true},
+		{pattern: "a.example.com", name: "b.example.com", want: false},
+		{pattern: "*.example.com", name: "a.example.com", want: true},
+		{pattern: "*.example.com", name: "A.EXAMPLE.com", want: true},
+		{pattern: "*.example.com", name: "example.com", want: false},
+		{pattern: "*.example.com", name: ".example.com", want: false},
+		{pattern: "*.example.com", name: "a.b.example.com", want: false},
+		{pattern: "*.example.com", name: "a.example.org", want: false},
+		{pattern: "*.example.com", name: "aexample.com", want: false},
+		{pattern: "*.example.com", name: "*.example.com", want: false},
+		{pattern: "a.example.com", name: "*.example.com", want: false},
+		{pattern: "a*.example.com", name: "ab.example.com", want: false},
+		{pattern: "*", name: "localhost", want: false},
+		{pattern: "a.*.com", name: "a.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := dnsMatch(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("dnsMatch(%q, %q): got %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleAllowList(t *testing.T) {
+	rules := `
+rules:
+  - uri_sans: ["spiffe://example.org/ns/*/sa/*"]
+    issuers: ["example issuing ca"]
+    username: uri
+    roles: ["workload"]
+  - email_sans: ["*@example.com"]
+    organizational_units: ["engineering"]
+    username: email
+  - dns_names: ["*.svc.example.com"]
+    username: dns
+  - organizations: ["example admins"]
+    roles: ["admin"]
+`
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := NewRuleAllowList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffe := func(path string) []*url.URL {
+		return []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: path}}
+	}
+
+	tests := []struct {
+		name  string
+		cert  *x509.Certificate
+		user  string
+		roles []string
+	}{
+		{
+			name: "spiffe workload",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{CommonName: "web"},
+				Issuer:  pkix.Name{CommonName: "example issuing ca"},
+				URIs:    spiffe("/ns/prod/sa/web"),
+			},
+			user:  "spiffe://example.org/ns/prod/sa/web",
+			roles: []string{"workload"},
+		},
+		{
+			name: "spiffe workload from another issuer",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{CommonName: "web"},
+				Issuer:  pkix.Name{CommonName: "other ca"},
+				URIs:    spiffe("/ns/prod/sa/web"),
+			},
+		},
+		{
+			name: "spiffe path too deep",
+			cert: &x509.Certificate{
+				Issuer: pkix.Name{CommonName: "example issuing ca"},
+				URIs:   spiffe("/ns/prod/sa/web/extra"),
+			},
+		},
+		{
+			name: "email in OU",
+			cert: &x509.Certificate{
+				Subject:        pkix.Name{CommonName: "carol", OrganizationalUnit: []string{"sales", "engineering"}},
+				EmailAddresses: []string{"carol@example.org", "carol@example.com"},
+			},
+			user: "carol@example.com",
+		},
+		{
+			name: "email outside OU",
+			cert: &x509.Certificate{
+				Subject:        pkix.Name{CommonName: "carol", OrganizationalUnit: []string{"sales"}},
+				EmailAddresses: []string{"carol@example.com"},
+			},
+		},
+		{
+			name: "wildcard DNS rule",
+			cert: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "api"},
+				DNSNames: []string{"api.example.com", "api.svc.example.com"},
+			},
+			user: "api.svc.example.com",
+		},
+		{
+			name: "wildcard DNS certificate",
+			cert: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "api"},
+				DNSNames: []string{"*.svc.example.com"},
+			},
+		},
+		{
+			name: "organization with CN username",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{CommonName: "dave", Organization: []string{"example admins"}},
+			},
+			user:  "dave",
+			roles: []string{"admin"},
+		},
+		{
+			name: "organization without a CN",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{Organization: []string{"example admins"}},
+			},
+		},
+		{
+			name: "no match",
+			cert: &x509.Certificate{Subject: pkix.Name{CommonName: "eve"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cert.SerialNumber = big.NewInt(1)
+			principal, err := list.Allow(tt.cert)
+			if tt.user == "" {
+				if !errors.Is(err, ErrNoCertMatch) {
+					t.Fatalf("expected no match, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.Name != tt.user {
+				t.Errorf("got user %q, want %q", principal.Name, tt.user)
+			}
+			if !slices.Equal(principal.Roles, tt.roles) {
+				t.Errorf("got roles %v, want %v", principal.Roles, tt.roles)
+			}
+		})
+	}
+}
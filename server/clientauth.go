@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// ClientAuthMode decides whether clients authenticate with TLS certificates.
+type ClientAuthMode int
+
+const (
+	// ClientAuthOff never asks clients for certificates, so callers must use bearer tokens.
+	ClientAuthOff ClientAuthMode = iota
+	// ClientAuthOptional verifies client certificates when they are given,
+	// and falls back to bearer tokens when they are not.
+	ClientAuthOptional
+	// ClientAuthRequired rejects TLS handshakes without a valid client certificate,
+	// and does not accept bearer tokens.
+	ClientAuthRequired
+)
+
+// ParseClientAuthMode parses "off", "optional" or "required".
+func ParseClientAuthMode(mode string) (ClientAuthMode, error) {
+	switch mode {
+	case "off":
+		return ClientAuthOff, nil
+	case "optional":
+		return ClientAuthOptional, nil
+	case "required":
+		return ClientAuthRequired, nil
+	default:
+		return ClientAuthOff, fmt.Errorf("unknown client auth mode: %q", mode)
+	}
+}
+
+func (m ClientAuthMode) String() string {
+	switch m {
+	case ClientAuthOptional:
+		return "optional"
+	case ClientAuthRequired:
+		return "required"
+	default:
+		return "off"
+	}
+}
+
+// TLSClientAuth is the equivalent tls.Config ClientAuth setting.
+func (m ClientAuthMode) TLSClientAuth() tls.ClientAuthType {
+	switch m {
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
+
+// Auth describes how a service authenticates & authorizes its callers.
+type Auth struct {
+	Tokens     TokenAuth
+	AllowList  AllowList
+	Authorizer Authorizer
+	ClientAuth ClientAuthMode
+	// Proxies are the client certificates of HTTP gateways that
+	// may forward the identities of the callers they authenticated.
+	Proxies AllowList
+	// Peers are the local users that may authenticate with
+	// their peer credentials when connecting over unix sockets.
+	Peers PeerAllowList
+	// ProtoRoles enforces the example.auth.required_roles
+	// options declared on the methods of the served APIs.
+	ProtoRoles bool
+}
+
+// Validate checks that the client auth mode can be used with the allow list.
+func (a Auth) Validate() error {
+	if a.ClientAuth == ClientAuthRequired && !a.certsEnabled() {
+		return fmt.Errorf("required client auth needs an allow list of client certificates")
+	}
+	if a.ProxiesEnabled() && a.ClientAuth == ClientAuthOff {
+		return fmt.Errorf("trusted proxies need client auth")
+	}
+	return nil
+}
+
+// MTLS returns the client auth mode in effect, which is
+// off when there are no allowed client certificates.
+func (a Auth) MTLS() ClientAuthMode {
+	if !a.certsEnabled() {
+		return ClientAuthOff
+	}
+	return a.ClientAuth
+}
+
+// ProxiesEnabled returns true when there are trusted proxies.
+func (a Auth) ProxiesEnabled() bool {
+	return a.Proxies != nil && a.Proxies.Enabled()
+}
+
+// PeersEnabled returns true when local users may authenticate with their peer credentials.
+func (a Auth) PeersEnabled() bool {
+	return a.Peers != nil && a.Peers.Enabled()
+}
+
+func (a Auth) certsEnabled() bool {
+	return a.AllowList.Enabled() || a.ProxiesEnabled()
+}
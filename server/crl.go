@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrCertRevoked authentication failure
+var ErrCertRevoked = errors.New("certificate revoked")
+
+// ErrRevocationUnknown authentication failure
+var ErrRevocationUnknown = errors.New("certificate revocation status unknown")
+
+// RevocationChecker decides whether a client certificate has been revoked.
+// The issuer is the certificate that signed it, taken from the verified
+// chain, or nil when the certificate was issued by a configured CA.
+type RevocationChecker interface {
+	Check(cert, issuer *x509.Certificate) error
+}
+
+type crlChecker struct {
+	caFile            string
+	intermediateFiles []string
+	crlFiles          []string
+	crls              atomic.Pointer[[]*loadedCRL]
+}
+
+type loadedCRL struct {
+	file    string
+	crl     *x509.RevocationList
+	signer  *x509.Certificate
+	revoked map[string]time.Time
+}
+
+// NewCRLChecker creates a RevocationChecker from CRL files that must be signed by
+// either a CA certificate in the CA file, or an intermediate CA in the intermediate
+// files that chains up to one of them, so that a wrong CRL cannot be silently ignored.
+// The CRLs are reloaded every refresh interval until the context is cancelled,
+// and the previously loaded CRLs stay in use when a reload fails.
+func NewCRLChecker(ctx context.Context, caFile string, intermediateFiles, crlFiles []string, refresh time.Duration) (RevocationChecker, error) {
+	c := &crlChecker{caFile: caFile, intermediateFiles: intermediateFiles, crlFiles: crlFiles}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	if refresh > 0 {
+		go c.refreshLoop(ctx, refresh)
+	}
+	return c, nil
+}
+
+func (c *crlChecker) Check(cert, issuer *x509.Certificate) error {
+	for _, lc := range *c.crls.Load() {
+		if !bytes.Equal(lc.crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		// a different CA that happens to have the same name
+		if issuer != nil && !bytes.Equal(issuer.RawSubjectPublicKeyInfo, lc.signer.RawSubjectPublicKeyInfo) {
+			continue
+		}
+		if at, ok := lc.revoked[cert.SerialNumber.String()]; ok {
+			return fmt.Errorf("%w - serial: %s, revoked at: %s", ErrCertRevoked, cert.SerialNumber, at)
+		}
+	}
+	return nil
+}
+
+func (c *crlChecker) refreshLoop(ctx context.Context, refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.reload(); err != nil {
+				log.WithError(err).Error("CRL reload failed, keeping previous CRLs")
+			}
+		}
+	}
+}
+
+func (c *crlChecker) reload() error {
+	signers, err := readCertificates(c.caFile)
+	if err != nil {
+		return fmt.Errorf("cannot read CRL issuer: %w", err)
+	}
+	intermediates, err := c.intermediates(signers)
+	if err != nil {
+		return err
+	}
+	signers = append(signers, intermediates...)
+	var crls []*loadedCRL
+	for _, crlFile := range c.crlFiles {
+		crl, err := readCRL(crlFile)
+		if err != nil {
+			return fmt.Errorf("cannot read CRL %s: %w", crlFile, err)
+		}
+		lc := &loadedCRL{file: crlFile, crl: crl, revoked: make(map[string]time.Time)}
+		for _, signer := range signers {
+			if crl.CheckSignatureFrom(signer) == nil {
+				lc.signer = signer
+				break
+			}
+		}
+		if lc.signer == nil {
+			return fmt.Errorf("CRL %s is not signed by a known CA: %s", crlFile, crl.Issuer)
+		}
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.WithField("crl", crlFile).WithField("next_update", crl.NextUpdate).Warn("CRL is out of date")
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			lc.revoked[entry.SerialNumber.String()] = entry.RevocationTime
+		}
+		crls = append(crls, lc)
+	}
+	c.crls.Store(&crls)
+	return nil
+}
+
+// intermediates returns the CA certificates in the intermediate files
+// that chain up to one of the root CAs.
+func (c *crlChecker) intermediates(roots []*x509.Certificate) ([]*x509.Certificate, error) {
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+	var candidates []*x509.Certificate
+	interPool := x509.NewCertPool()
+	for _, file := range c.intermediateFiles {
+		certs, err := readCertificates(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read intermediate CA: %w", err)
+		}
+		for _, cert := range certs {
+			// certificate files may also hold the leaf
+			if cert.IsCA {
+				candidates = append(candidates, cert)
+				interPool.AddCert(cert)
+			}
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: interPool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range candidates {
+		if _, err := cert.Verify(opts); err != nil {
+			return nil, fmt.Errorf("intermediate CA %s: %w", cert.Subject, err)
+		}
+	}
+	return candidates, nil
+}
+
+func readCertificate(filename string) (*x509.Certificate, error) {
+	certs, err := readCertificates(filename)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+func readCertificates(filename string) ([]*x509.Certificate, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, buf = pem.Decode(buf)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("bad certificate in %s: %w", filename, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found in %s", filename)
+	}
+	return certs, nil
+}
+
+func readCRL(filename string) (*x509.RevocationList, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// accept both PEM and DER encoded CRLs
+	if block, _ := pem.Decode(buf); block != nil {
+		buf = block.Bytes
+	}
+	return x509.ParseRevocationList(buf)
+}
+
+type revocationAllowList struct {
+	next     AllowList
+	checkers []RevocationChecker
+}
+
+// NewRevocationAllowList rejects revoked certificates before checking them against the next AllowList.
+func NewRevocationAllowList(next AllowList, checkers ...RevocationChecker) AllowList {
+	return &revocationAllowList{next: next, checkers: checkers}
+}
+
+func (r *revocationAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
+	return r.AllowChain([]*x509.Certificate{cert})
+}
+
+func (r *revocationAllowList) AllowChain(chain []*x509.Certificate) (*Principal, error) {
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	for _, checker := range r.checkers {
+		if err := checker.Check(chain[0], issuer); err != nil {
+			return nil, err
+		}
+	}
+	return AllowChain(r.next, chain)
+}
+
+func (r *revocationAllowList) Enabled() bool {
+	return r.next.Enabled()
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCRLChecker(t *testing.T) {
+	dir := t.TempDir()
+	root, rootKey := newTestCA(t, "root", nil, nil)
+	issuing, issuingKey := newTestCA(t, "issuing", root, rootKey)
+	other, otherKey := newTestCA(t, "other", nil, nil)
+	writePEM(t, dir, "ca.crt", "CERTIFICATE", root.Raw)
+	writePEM(t, dir, "issuing.crt", "CERTIFICATE", issuing.Raw)
+	writePEM(t, dir, "ca.crl", "X509 CRL", newTestCRL(t, root, rootKey, 42))
+	writePEM(t, dir, "issuing.crl", "X509 CRL", newTestCRL(t, issuing, issuingKey, 43))
+	writePEM(t, dir, "other.crl", "X509 CRL", newTestCRL(t, other, otherKey, 44))
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	ctx := context.Background()
+
+	checker, err := NewCRLChecker(ctx, path("ca.crt"), []string{path("issuing.crt")}, []string{path("ca.crl"), path("issuing.crl")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := &x509.Certificate{SerialNumber: big.NewInt(43), RawIssuer: issuing.RawSubject}
+	if err = checker.Check(revoked, issuing); !errors.Is(err, ErrCertRevoked) {
+		t.Errorf("expected revoked, got %v", err)
+	}
+	valid := &x509.Certificate{SerialNumber: big.NewInt(42), RawIssuer: issuing.RawSubject}
+	if err = checker.Check(valid, issuing); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+
+	if _, err = NewCRLChecker(ctx, path("ca.crt"), nil, []string{path("issuing.crl")}, 0); err == nil {
+		t.Error("expected an intermediate CRL without its intermediate to be rejected")
+	}
+	if _, err = NewCRLChecker(ctx, path("ca.crt"), nil, []string{path("other.crl")}, 0); err == nil {
+		t.Error("expected an unknown CA's CRL to be rejected")
+	}
+	writePEM(t, dir, "other.crt", "CERTIFICATE", other.Raw)
+	if _, err = NewCRLChecker(ctx, path("ca.crt"), []string{path("other.crt")}, []string{path("other.crl")}, 0); err == nil {
+		t.Error("expected an intermediate that does not chain to the CA to be rejected")
+	}
+}
+
+func newTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestCRL(t *testing.T, ca *x509.Certificate, key *ecdsa.PrivateKey, serial int64) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()},
+		},
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	buf := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
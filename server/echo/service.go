@@ -20,7 +20,11 @@ func NewExampleServer() api.ExampleServer {
 }
 
 func (s *plainServer) Echo(ctx context.Context, in *api.EchoRequest) (*api.EchoResponse, error) {
-	log.WithField("user", server.UserName(ctx)).Info(in.Message)
+	ll := log.WithField("user", server.UserName(ctx))
+	if principal := server.CurrentPrincipal(ctx); principal != nil {
+		ll = ll.WithField("auth", principal.Method)
+	}
+	ll.Info(in.Message)
 	return &api.EchoResponse{
 		Message:   in.Message,
 		CreatedAt: timestamppb.Now(),
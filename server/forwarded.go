@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ForwardedPrincipalKey is the gRPC metadata key that an HTTP gateway uses
+// to tell a remote gRPC server who it has authenticated.
+const ForwardedPrincipalKey = "x-forwarded-principal"
+
+// ErrUntrustedProxy authentication failure
+var ErrUntrustedProxy = errors.New("forwarded principal from untrusted proxy")
+
+type forwardedPrincipal struct {
+	Name            string            `json:"name"`
+	Method          AuthMethod        `json:"method"`
+	Roles           []string          `json:"roles,omitempty"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+	CertFingerprint string            `json:"cert_fingerprint,omitempty"`
+	TokenID         string            `json:"token_id,omitempty"`
+	Expiry          time.Time         `json:"expiry,omitempty"`
+}
+
+// EncodePrincipal encodes the principal as a ForwardedPrincipalKey metadata value.
+func EncodePrincipal(p *Principal) (string, error) {
+	buf, err := json.Marshal(forwardedPrincipal(*p))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// DecodePrincipal decodes a ForwardedPrincipalKey metadata value, and records
+// the name of the proxy that forwarded it in the principal's attributes.
+func DecodePrincipal(value string, proxy *Principal) (*Principal, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("bad forwarded principal: %w", err)
+	}
+	var fp forwardedPrincipal
+	if err = json.Unmarshal(buf, &fp); err != nil {
+		return nil, fmt.Errorf("bad forwarded principal: %w", err)
+	}
+	if fp.Name == "" {
+		return nil, fmt.Errorf("bad forwarded principal: no name")
+	}
+	if !fp.Expiry.IsZero() && time.Now().After(fp.Expiry) {
+		return nil, fmt.Errorf("forwarded principal %s expired at %s", fp.Name, fp.Expiry)
+	}
+	p := Principal(fp)
+	if p.Attributes == nil {
+		p.Attributes = make(map[string]string)
+	}
+	p.Attributes["proxy"] = proxy.Name
+	return &p, nil
+}
@@ -2,25 +2,52 @@ package grpcx
 
 import (
 	"context"
+	"crypto/x509"
+	"fmt"
 
 	mw "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/tomcz/example-grpc/server"
 )
 
-func authMiddleware(authFunc mw.AuthFunc) []grpc.ServerOption {
+func authMiddleware(authFunc mw.AuthFunc, authz server.Authorizer) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{mw.UnaryServerInterceptor(authFunc)}
+	stream := []grpc.StreamServerInterceptor{mw.StreamServerInterceptor(authFunc)}
+	if authz.Enabled() {
+		unary = append(unary, authzUnaryInterceptor(authz))
+		stream = append(stream, authzStreamInterceptor(authz))
+	}
 	return []grpc.ServerOption{
 		// echo service only has unary endpoints, but ...
-		grpc.UnaryInterceptor(mw.UnaryServerInterceptor(authFunc)),
+		grpc.ChainUnaryInterceptor(unary...),
 		// grpcurl uses a streaming endpoint for reflection,
 		// so let's make sure the user is allowed to reflect
-		grpc.StreamInterceptor(mw.StreamServerInterceptor(authFunc)),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+func authzUnaryInterceptor(authz server.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authz.Authorize(server.CurrentPrincipal(ctx), info.FullMethod); err != nil {
+			return nil, accessDenied(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authzStreamInterceptor(authz server.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authz.Authorize(server.CurrentPrincipal(ss.Context()), info.FullMethod); err != nil {
+			return accessDenied(err)
+		}
+		return handler(srv, ss)
 	}
 }
 
@@ -30,35 +57,79 @@ func newServerAuthFunc(auth server.TokenAuth) mw.AuthFunc {
 		if err != nil {
 			return nil, err
 		}
-		username, err := auth.Authenticate(token)
+		principal, err := auth.Authenticate(token)
 		if err != nil {
 			return authFailed(err)
 		}
-		return server.WithUserName(ctx, username), nil
+		return server.WithPrincipal(ctx, principal), nil
 	}
 }
 
 func newMTLSAuthFunc(mtls server.AllowList, next mw.AuthFunc) mw.AuthFunc {
 	return func(ctx context.Context) (context.Context, error) {
-		if p, ok := peer.FromContext(ctx); ok {
-			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
-				certs := tlsInfo.State.PeerCertificates
-				if len(certs) > 0 {
-					// we want the first cert in the chain as that is the actual client cert
-					username, err := mtls.Allow(certs[0])
-					if err != nil {
-						return authFailed(err)
-					}
-					return server.WithUserName(ctx, username), nil
-				}
+		certs := peerChain(ctx)
+		if len(certs) > 0 {
+			// the first cert in the chain is the actual client cert
+			principal, err := server.AllowChain(mtls, certs)
+			if err != nil {
+				return authFailed(err)
 			}
+			return server.WithPrincipal(ctx, principal), nil
 		}
 		return next(ctx)
 	}
 }
 
+// newProxyAuthFunc accepts the identities forwarded by trusted HTTP gateways,
+// which have already authenticated their callers.
+func newProxyAuthFunc(proxies server.AllowList, next mw.AuthFunc) mw.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		values := metadata.ValueFromIncomingContext(ctx, server.ForwardedPrincipalKey)
+		if len(values) == 0 {
+			return next(ctx)
+		}
+		if len(values) > 1 {
+			// a gateway only ever forwards the one principal that it authenticated
+			return authFailed(fmt.Errorf("bad forwarded principal: %d values", len(values)))
+		}
+		certs := peerChain(ctx)
+		if len(certs) == 0 {
+			return authFailed(server.ErrUntrustedProxy)
+		}
+		proxy, err := server.AllowChain(proxies, certs)
+		if err != nil {
+			return authFailed(fmt.Errorf("%w: %w", server.ErrUntrustedProxy, err))
+		}
+		principal, err := server.DecodePrincipal(values[0], proxy)
+		if err != nil {
+			return authFailed(err)
+		}
+		return server.WithPrincipal(ctx, principal), nil
+	}
+}
+
+func peerChain(ctx context.Context) []*x509.Certificate {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return server.ClientChain(tlsInfo.State)
+		}
+	}
+	return nil
+}
+
+// the TLS handshake should have already rejected clients without certificates
+func requireClientCert(context.Context) (context.Context, error) {
+	return nil, status.Error(codes.Unauthenticated, "client certificate required")
+}
+
 func authFailed(err error) (context.Context, error) {
 	errorID := server.ErrorID()
 	log.WithError(err).WithField("error_id", errorID).Warn("auth failed")
 	return nil, status.Errorf(codes.PermissionDenied, "error_id: %s", errorID)
 }
+
+func accessDenied(err error) error {
+	errorID := server.ErrorID()
+	log.WithError(err).WithField("error_id", errorID).Warn("access denied")
+	return status.Errorf(codes.PermissionDenied, "error_id: %s", errorID)
+}
@@ -0,0 +1,94 @@
+package grpcx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestProxyAuthFunc(t *testing.T) {
+	gateway := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "gateway.example.com"}}
+	revoked := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "gateway.example.com"}}
+	other := &x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "alice.example.com"}}
+	encode := func(p *server.Principal) string {
+		value, err := server.EncodePrincipal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	alice := encode(&server.Principal{Name: "alice"})
+	admin := encode(&server.Principal{Name: "admin"})
+	expired := encode(&server.Principal{Name: "alice", Expiry: time.Now().Add(-time.Minute)})
+
+	tests := []struct {
+		name   string
+		cert   *x509.Certificate
+		values []string
+		want   string
+	}{
+		{name: "forwarded", cert: gateway, values: []string{alice}, want: "alice"},
+		{name: "not forwarded", cert: gateway, want: "next"},
+		{name: "untrusted proxy", cert: other, values: []string{alice}},
+		{name: "revoked proxy", cert: revoked, values: []string{alice}},
+		{name: "no client cert", values: []string{alice}},
+		{name: "several principals", cert: gateway, values: []string{admin, alice}},
+		{name: "expired principal", cert: gateway, values: []string{expired}},
+		{name: "garbage", cert: gateway, values: []string{"not a principal"}},
+	}
+	next := func(ctx context.Context) (context.Context, error) {
+		return server.WithUserName(ctx, "next"), nil
+	}
+	proxies := server.NewRevocationAllowList(server.NewDomainAllowList("gateway.example.com"), revokedSerials{revoked.SerialNumber})
+	authFunc := newProxyAuthFunc(proxies, next)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.cert != nil {
+				state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{tc.cert}}
+				ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+			}
+			md := metadata.MD{}
+			for _, value := range tc.values {
+				md.Append(server.ForwardedPrincipalKey, value)
+			}
+			ctx = metadata.NewIncomingContext(ctx, md)
+
+			ctx, err := authFunc(ctx)
+			if tc.want == "" {
+				if err == nil {
+					t.Fatalf("expected failure, got %s", server.UserName(ctx))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := server.UserName(ctx); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+type revokedSerials []*big.Int
+
+func (r revokedSerials) Check(cert, _ *x509.Certificate) error {
+	for _, serial := range r {
+		if cert.SerialNumber.Cmp(serial) == 0 {
+			return fmt.Errorf("%w - serial: %s", server.ErrCertRevoked, serial)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package grpcx
+
+import (
+	"context"
+	"net"
+
+	mw "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+// localCreds skips the TLS handshake on unix domain sockets, where callers are
+// local processes that can be identified by their peer credentials instead.
+type localCreds struct {
+	credentials.TransportCredentials
+}
+
+type peerAuthInfo struct {
+	credentials.CommonAuthInfo
+	creds *server.PeerCreds
+}
+
+func (peerAuthInfo) AuthType() string {
+	return "peercred"
+}
+
+func (c localCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(*net.UnixConn); !ok {
+		return c.TransportCredentials.ServerHandshake(conn)
+	}
+	creds, err := server.GetPeerCreds(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the same level that grpc's own local credentials give unix sockets
+	info := peerAuthInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		creds:          creds,
+	}
+	return conn, info, nil
+}
+
+func (c localCreds) Clone() credentials.TransportCredentials {
+	return localCreds{c.TransportCredentials.Clone()}
+}
+
+// newPeerAuthFunc authenticates local callers on unix sockets by their peer
+// credentials, and falls back to other methods for users that are not allowed.
+func newPeerAuthFunc(peers server.PeerAllowList, next mw.AuthFunc) mw.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		if creds := peerCreds(ctx); creds != nil {
+			if principal, err := peers.Allow(creds); err == nil {
+				return server.WithPrincipal(ctx, principal), nil
+			}
+		}
+		return next(ctx)
+	}
+}
+
+// peerCreds finds the caller's peer credentials in the handshake's auth info, or
+// in the HTTP connection's context when the gRPC server is served over HTTP/2
+// on a single port.
+func peerCreds(ctx context.Context) *server.PeerCreds {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(peerAuthInfo); ok && info.creds != nil {
+			return info.creds
+		}
+	}
+	return server.CurrentPeerCreds(ctx)
+}
@@ -0,0 +1,51 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/peer"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestPeerAuthFunc(t *testing.T) {
+	peers, err := server.NewPeerAllowList(strconv.Itoa(os.Getuid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errNext := errors.New("next")
+	authFunc := newPeerAuthFunc(peers, func(ctx context.Context) (context.Context, error) {
+		return ctx, errNext
+	})
+	allowed := &server.PeerCreds{UID: os.Getuid()}
+	other := &server.PeerCreds{UID: os.Getuid() + 1}
+	handshake := func(creds *server.PeerCreds) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: peerAuthInfo{creds: creds}})
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{name: "handshake", ctx: handshake(allowed)},
+		{name: "single port connection", ctx: server.WithPeerCreds(context.Background(), allowed)},
+		{name: "not allowed", ctx: handshake(other), want: errNext},
+		{name: "no credentials", ctx: context.Background(), want: errNext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := authFunc(tt.ctx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && server.CurrentPrincipal(ctx) == nil {
+				t.Fatal("expected a principal")
+			}
+		})
+	}
+}
@@ -1,12 +1,10 @@
 package grpcx
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"fmt"
-	"net"
-	"os"
+	"context"
+	"errors"
 
+	mw "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -14,73 +12,123 @@ import (
 
 	"github.com/tomcz/example-grpc/api"
 	"github.com/tomcz/example-grpc/server"
+	"github.com/tomcz/example-grpc/server/listen"
+	"github.com/tomcz/example-grpc/server/protoauthz"
+	"github.com/tomcz/example-grpc/tlsconfig"
 )
 
 type service struct {
+	*server.Readiness
 	server *grpc.Server
-	port   int
+	addrs  []string
 }
 
-// NewService creates a gRPC service
-func NewService(impl api.ExampleServer, port int, auth server.TokenAuth, mtls server.AllowList) (server.Service, error) {
-	authFunc := newServerAuthFunc(auth)
-	if mtls.Enabled() {
-		authFunc = newMTLSAuthFunc(mtls, authFunc)
-	}
-	grpcOpts := authMiddleware(authFunc)
-	tc, err := newTransportCredentials(mtls.Enabled())
+// NewService creates a gRPC service, which also serves the issuer when it is not nil.
+// The listener addresses are anything that listen.ListenAll accepts, and connections
+// on unix domain sockets do not use TLS.
+func NewService(impl api.ExampleServer, issuer api.IssuerServer, addrs []string, auth server.Auth, certs *tlsconfig.Reloader) (server.Service, error) {
+	creds := localCreds{credentials.NewTLS(certs.ServerConfig("h2"))}
+	srv, err := newServer(impl, issuer, auth, grpc.Creds(creds))
 	if err != nil {
 		return nil, err
 	}
-	grpcOpts = append(grpcOpts, grpc.Creds(tc))
-	srv := grpc.NewServer(grpcOpts...)
-	api.RegisterExampleServer(srv, impl)
-	reflection.Register(srv) // make it easy to use grpcurl
 	return &service{
-		server: srv,
-		port:   port,
+		Readiness: server.NewReadiness(),
+		server:    srv,
+		addrs:     addrs,
 	}, nil
 }
 
-func newTransportCredentials(allowMtls bool) (credentials.TransportCredentials, error) {
-	if allowMtls {
-		return newMTLSTransportCredentials()
-	}
-	return credentials.NewServerTLSFromFile("target/server.crt", "target/server.key")
+// NewHandler creates a gRPC server for use as the http.Handler of a TLS HTTP/2 server,
+// which then takes care of the TLS handshake and client certificate verification.
+// It applies the same authentication & authorization as NewService.
+func NewHandler(impl api.ExampleServer, issuer api.IssuerServer, auth server.Auth) (*grpc.Server, error) {
+	return newServer(impl, issuer, auth)
 }
 
-func newMTLSTransportCredentials() (credentials.TransportCredentials, error) {
-	caCert, err := os.ReadFile("target/ca.crt")
-	if err != nil {
-		return nil, fmt.Errorf("cannot read root CA cert: %w", err)
+func newServer(impl api.ExampleServer, issuer api.IssuerServer, auth server.Auth, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	if err := auth.Validate(); err != nil {
+		return nil, err
+	}
+	var authFunc mw.AuthFunc
+	switch auth.MTLS() {
+	case server.ClientAuthRequired:
+		authFunc = newMTLSAuthFunc(auth.AllowList, requireClientCert)
+	case server.ClientAuthOptional:
+		authFunc = newMTLSAuthFunc(auth.AllowList, newServerAuthFunc(auth.Tokens))
+	default:
+		authFunc = newServerAuthFunc(auth.Tokens)
+	}
+	if auth.ProxiesEnabled() {
+		authFunc = newProxyAuthFunc(auth.Proxies, authFunc)
 	}
-	caCertPool := x509.NewCertPool()
-	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
-		return nil, fmt.Errorf("failed to add root CA cert into cert pool")
+	if auth.PeersEnabled() {
+		authFunc = newPeerAuthFunc(auth.Peers, authFunc)
 	}
-	cert, err := tls.LoadX509KeyPair("target/server.crt", "target/server.key")
+	authz, err := NewAuthorizer(auth, issuer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load cert & key files: %w", err)
+		return nil, err
 	}
-	// if we wanted to make mTLS mandatory we should
-	// set ClientAuth to tls.RequireAndVerifyClientCert
-	cfg := &tls.Config{
-		ClientAuth:   tls.VerifyClientCertIfGiven,
-		ClientCAs:    caCertPool,
-		Certificates: []tls.Certificate{cert},
+	grpcOpts := authMiddleware(authFunc, authz)
+	grpcOpts = append(grpcOpts, opts...)
+	srv := grpc.NewServer(grpcOpts...)
+	api.RegisterExampleServer(srv, impl)
+	if issuer != nil {
+		api.RegisterIssuerServer(srv, issuer)
 	}
-	return credentials.NewTLS(cfg), nil
+	reflection.Register(srv) // make it easy to use grpcurl
+	return srv, nil
+}
+
+// NewAuthorizer returns the authorizer that NewService applies to requests, which
+// serve the issuer too when it is not nil, so that the HTTP gateway can apply the
+// same rules. When auth.ProtoRoles is set, it adds the required roles declared on
+// the methods of the registered services to the auth's Authorizer.
+func NewAuthorizer(auth server.Auth, issuer api.IssuerServer) (server.Authorizer, error) {
+	if !auth.ProtoRoles {
+		return auth.Authorizer, nil
+	}
+	services := []*grpc.ServiceDesc{&api.Example_ServiceDesc}
+	if issuer != nil {
+		services = append(services, &api.Issuer_ServiceDesc)
+	}
+	roles, err := protoauthz.NewAuthorizer(services...)
+	if err != nil {
+		return nil, err
+	}
+	return server.NewAuthorizerChain(roles, auth.Authorizer), nil
 }
 
 func (s *service) ListenAndServe() error {
-	log.WithField("port", s.port).Info("staring gRPC server")
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	listeners, err := listen.ListenAll(s.addrs)
 	if err != nil {
 		return err
 	}
-	return s.server.Serve(lis)
+	addrs := listen.Addrs(listeners)
+	for _, addr := range addrs {
+		log.WithField("addr", addr).Info("staring gRPC server")
+	}
+	s.SetReady(addrs)
+	err = listen.Serve(listeners, s.server.Serve)
+	// returned when the server is stopped before serving a listener
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
 }
 
-func (s *service) GracefulStop() {
-	s.server.GracefulStop()
+func (s *service) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// unblocks GracefulStop too
+		s.server.Stop()
+		return ctx.Err()
+	}
 }
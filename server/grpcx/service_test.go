@@ -0,0 +1,84 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestListenAndServeAfterShutdown(t *testing.T) {
+	s := &service{
+		Readiness: server.NewReadiness(),
+		server:    grpc.NewServer(),
+		addrs:     []string{"127.0.0.1:0", "127.0.0.1:0"},
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ListenAndServe(); err != nil {
+		t.Fatalf("expected a clean stop, got %v", err)
+	}
+}
+
+func TestListenAndServeShutdown(t *testing.T) {
+	s := &service{
+		Readiness: server.NewReadiness(),
+		server:    grpc.NewServer(),
+		addrs:     []string{"127.0.0.1:0", "127.0.0.1:0"},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe()
+	}()
+	select {
+	case <-s.Ready():
+	case err := <-done:
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected a clean stop, got %v", err)
+	}
+}
+
+func TestNewAuthorizer(t *testing.T) {
+	alice := &server.Principal{Name: "alice"}
+	echoer := &server.Principal{Name: "bob", Roles: []string{"echoer"}}
+	policy, err := server.LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := server.Auth{Authorizer: policy}
+
+	authz, err := NewAuthorizer(auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = authz.Authorize(alice, "/example.service.Example/Echo"); err != nil {
+		t.Fatalf("expected required roles to be ignored, got %v", err)
+	}
+
+	auth.ProtoRoles = true
+	authz, err = NewAuthorizer(auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = authz.Authorize(alice, "/example.service.Example/Echo"); !errors.Is(err, server.ErrAccessDenied) {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+	if err = authz.Authorize(alice, "POST /v1/example/echo"); !errors.Is(err, server.ErrAccessDenied) {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+	if err = authz.Authorize(echoer, "/example.service.Example/Echo"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,12 @@
 package httpx
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/tomcz/example-grpc/server"
@@ -12,8 +14,7 @@ import (
 
 func authMiddleware(auth server.TokenAuth, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		username := server.UserName(r.Context())
-		if username != "" {
+		if server.CurrentPrincipal(r.Context()) != nil {
 			// already authenticated
 			next.ServeHTTP(w, r)
 			return
@@ -32,33 +33,87 @@ func authMiddleware(auth server.TokenAuth, next http.Handler) http.Handler {
 			http.Error(w, "Unsupported Authorization scheme", http.StatusUnauthorized)
 			return
 		}
-		var err error
-		username, err = auth.Authenticate(pair[1])
+		principal, err := auth.Authenticate(pair[1])
 		if err != nil {
 			authFailed(w, err)
 			return
 		}
-		r = r.WithContext(server.WithUserName(r.Context(), username))
+		r = r.WithContext(server.WithPrincipal(r.Context(), principal))
 		next.ServeHTTP(w, r)
 	})
 }
 
-func mtlsMiddleware(mtls server.AllowList, next http.Handler) http.Handler {
+func mtlsMiddleware(mtls server.AllowList, required bool, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		certs := r.TLS.PeerCertificates
+		if server.CurrentPrincipal(r.Context()) != nil {
+			// already authenticated
+			next.ServeHTTP(w, r)
+			return
+		}
+		var certs []*x509.Certificate
+		if r.TLS != nil {
+			// unix socket connections do not use TLS
+			certs = server.ClientChain(*r.TLS)
+		}
+		if required && len(certs) == 0 {
+			// the TLS handshake should have already rejected this request
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
 		if len(certs) > 0 {
-			// we want the first cert in the chain as that is the actual client cert
-			username, err := mtls.Allow(certs[0])
+			// the first cert in the chain is the actual client cert
+			principal, err := server.AllowChain(mtls, certs)
 			if err != nil {
 				authFailed(w, err)
 				return
 			}
-			r = r.WithContext(server.WithUserName(r.Context(), username))
+			r = r.WithContext(server.WithPrincipal(r.Context(), principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peerMiddleware authenticates local callers on unix sockets by their peer
+// credentials, and leaves users that are not allowed to the other middleware.
+func peerMiddleware(peers server.PeerAllowList, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if creds := server.CurrentPeerCreds(r.Context()); creds != nil {
+			if principal, err := peers.Allow(creds); err == nil {
+				r = r.WithContext(server.WithPrincipal(r.Context(), principal))
+			}
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authzMiddleware runs inside the gateway, after it has routed the request, so
+// that resources are named by the matched route pattern and the method that the
+// gateway dispatched on (including any X-HTTP-Method-Override), rather than by a
+// raw path that escaped characters or extra slashes could disguise.
+func authzMiddleware(authz server.Authorizer) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			pattern, ok := runtime.HTTPPattern(r.Context())
+			if !ok {
+				accessDenied(w, fmt.Errorf("%w - no route pattern for %s %s", server.ErrAccessDenied, r.Method, r.URL.Path))
+				return
+			}
+			resource := fmt.Sprintf("%s %s", r.Method, pattern)
+			if err := authz.Authorize(server.CurrentPrincipal(r.Context()), resource); err != nil {
+				accessDenied(w, err)
+				return
+			}
+			next(w, r, pathParams)
+		}
+	}
+}
+
+func accessDenied(w http.ResponseWriter, err error) {
+	errorID := server.ErrorID()
+	log.WithError(err).WithField("error_id", errorID).Warn("access denied")
+	http.Error(w, fmt.Sprintf("Access denied - error_id: %s", errorID), http.StatusForbidden)
+}
+
 func authFailed(w http.ResponseWriter, err error) {
 	errorID := server.ErrorID()
 	log.WithError(err).WithField("error_id", errorID).Warn("auth failed")
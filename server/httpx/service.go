@@ -3,110 +3,297 @@ package httpx
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"time"
+	"strings"
 
 	"github.com/gorilla/handlers"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	log "github.com/sirupsen/logrus"
-	"github.com/tomcz/gotools/quiet"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/tomcz/example-grpc/api"
 	"github.com/tomcz/example-grpc/server"
+	"github.com/tomcz/example-grpc/server/grpcx"
+	"github.com/tomcz/example-grpc/server/listen"
+	"github.com/tomcz/example-grpc/tlsconfig"
 )
 
 type service struct {
+	*server.Readiness
 	server *http.Server
-	mtls   bool
-	port   int
+	grpc   *grpc.Server
+	mtls   server.ClientAuthMode
+	addrs  []string
 }
 
-// NewService creates an HTTP service
-func NewService(ctx context.Context, impl api.ExampleServer, port int, auth server.TokenAuth, mtls server.AllowList) (server.Service, error) {
-	handler, err := httpHandler(ctx, impl)
+// Backend is a remote gRPC server that handles the requests of an HTTP gateway.
+type Backend struct {
+	Addr string
+	// TLS should have a client certificate that the backend trusts to forward
+	// the identities of authenticated callers.
+	TLS *tls.Config
+}
+
+// NewService creates an HTTP service, which also serves the issuer when it is not nil.
+func NewService(ctx context.Context, impl api.ExampleServer, issuer api.IssuerServer, addrs []string, auth server.Auth, certs *tlsconfig.Reloader) (server.Service, error) {
+	authz, err := grpcx.NewAuthorizer(auth, issuer)
 	if err != nil {
 		return nil, err
 	}
-	handler = authMiddleware(auth, handler)
-	if mtls.Enabled() {
-		handler = mtlsMiddleware(mtls, handler)
+	handler, err := httpHandler(ctx, impl, issuer, authz)
+	if err != nil {
+		return nil, err
 	}
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: handler,
+	handler, err = authHandler(handler, auth)
+	if err != nil {
+		return nil, err
+	}
+	return newService(handler, nil, addrs, auth, certs), nil
+}
+
+// NewProxyService creates an HTTP service that forwards requests to a remote gRPC
+// backend, instead of calling the service implementations in-process, so that the
+// backend's interceptors apply to them. The backend is told who the caller is.
+func NewProxyService(ctx context.Context, backend Backend, addrs []string, auth server.Auth, certs *tlsconfig.Reloader) (server.Service, error) {
+	// the backend enforces the required roles of its methods
+	handler, err := proxyHandler(ctx, backend, auth.Authorizer)
+	if err != nil {
+		return nil, err
+	}
+	handler, err = authHandler(handler, auth)
+	if err != nil {
+		return nil, err
+	}
+	return newService(handler, nil, addrs, auth, certs), nil
+}
+
+// NewSinglePortService creates an HTTP service that also serves gRPC on the same port.
+// HTTP/2 requests with an application/grpc content type go to the gRPC server, which
+// does its own authentication, and everything else goes to the grpc-gateway handler.
+func NewSinglePortService(ctx context.Context, impl api.ExampleServer, issuer api.IssuerServer, addrs []string, auth server.Auth, certs *tlsconfig.Reloader) (server.Service, error) {
+	authz, err := grpcx.NewAuthorizer(auth, issuer)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := httpHandler(ctx, impl, issuer, authz)
+	if err != nil {
+		return nil, err
+	}
+	handler, err = authHandler(handler, auth)
+	if err != nil {
+		return nil, err
 	}
-	if err = mtlsConfig(srv, mtls); err != nil {
+	grpcSrv, err := grpcx.NewHandler(impl, issuer, auth)
+	if err != nil {
 		return nil, err
 	}
+	return newService(h2cHandler(grpcHandler(grpcSrv, handler)), grpcSrv, addrs, auth, certs), nil
+}
+
+func newService(handler http.Handler, grpcSrv *grpc.Server, addrs []string, auth server.Auth, certs *tlsconfig.Reloader) *service {
+	srv := &http.Server{
+		Handler:     handler,
+		TLSConfig:   certs.ServerConfig("h2", "http/1.1"),
+		ConnContext: peerCredsContext,
+	}
 	return &service{
-		server: srv,
-		mtls:   mtls.Enabled(),
-		port:   port,
-	}, nil
+		Readiness: server.NewReadiness(),
+		server:    srv,
+		grpc:      grpcSrv,
+		mtls:      auth.MTLS(),
+		addrs:     addrs,
+	}
 }
 
-func httpHandler(ctx context.Context, impl api.ExampleServer) (http.Handler, error) {
-	// yes, we are matching all incoming input as JSON, but see note below
-	httpMux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{}))
+func authHandler(handler http.Handler, auth server.Auth) (http.Handler, error) {
+	if err := auth.Validate(); err != nil {
+		return nil, err
+	}
+	mode := auth.MTLS()
+	if mode != server.ClientAuthRequired {
+		// no bearer token fallback when client certs are mandatory
+		handler = authMiddleware(auth.Tokens, handler)
+	}
+	if mode != server.ClientAuthOff {
+		handler = mtlsMiddleware(auth.AllowList, mode == server.ClientAuthRequired, handler)
+	}
+	if auth.PeersEnabled() {
+		handler = peerMiddleware(auth.Peers, handler)
+	}
+	return handler, nil
+}
+
+func peerCredsContext(ctx context.Context, conn net.Conn) context.Context {
+	creds, err := server.GetPeerCreds(conn)
+	if err != nil {
+		log.WithError(err).Warn("cannot get peer credentials")
+		return ctx
+	}
+	if creds != nil {
+		return server.WithPeerCreds(ctx, creds)
+	}
+	return ctx
+}
+
+func grpcHandler(grpcSrv *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// h2cHandler serves HTTP/2 without TLS on unix sockets, so that gRPC clients can
+// reach the gRPC server there too. Connections that arrived over TLS negotiate
+// HTTP/2 with ALPN instead, and must not be upgraded to h2c.
+func h2cHandler(next http.Handler) http.Handler {
+	plaintext := h2c.NewHandler(next, &http2.Server{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			plaintext.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func httpHandler(ctx context.Context, impl api.ExampleServer, issuer api.IssuerServer, authz server.Authorizer) (http.Handler, error) {
+	httpMux := newMux(authzOption(authz))
 	err := api.RegisterExampleHandlerServer(ctx, httpMux, impl)
 	if err != nil {
 		return nil, fmt.Errorf("grpc-gateway registration failed: %w", err)
 	}
-	// NOTE: grpc-gateway does not play nice with anything other than JSON request bodies,
-	// unless you want to do your own parsing from HttpBody instances, but it does not check
-	// that the Content-Type is actually JSON, so let's enforce that a bit.
-	return handlers.ContentTypeHandler(httpMux, "application/json"), nil
+	if issuer != nil {
+		err = api.RegisterIssuerHandlerServer(ctx, httpMux, issuer)
+		if err != nil {
+			return nil, fmt.Errorf("grpc-gateway registration failed: %w", err)
+		}
+	}
+	return jsonOnly(httpMux), nil
 }
 
-func mtlsConfig(srv *http.Server, mtls server.AllowList) error {
-	if !mtls.Enabled() {
-		return nil
+func proxyHandler(ctx context.Context, backend Backend, authz server.Authorizer) (http.Handler, error) {
+	httpMux := newMux(
+		authzOption(authz),
+		runtime.WithIncomingHeaderMatcher(dropForwardedPrincipal),
+		runtime.WithMetadata(forwardPrincipal),
+	)
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(backend.TLS))}
+	err := api.RegisterExampleHandlerFromEndpoint(ctx, httpMux, backend.Addr, opts)
+	if err != nil {
+		return nil, fmt.Errorf("grpc-gateway registration failed: %w", err)
 	}
-	caCert, err := os.ReadFile("target/ca.crt")
+	// the backend responds with Unimplemented when it has no issuer
+	err = api.RegisterIssuerHandlerFromEndpoint(ctx, httpMux, backend.Addr, opts)
 	if err != nil {
-		return fmt.Errorf("cannot read root CA cert: %w", err)
+		return nil, fmt.Errorf("grpc-gateway registration failed: %w", err)
 	}
-	caCertPool := x509.NewCertPool()
-	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
-		return fmt.Errorf("failed to add root CA cert into cert pool")
+	return jsonOnly(httpMux), nil
+}
+
+// dropForwardedPrincipal stops callers from forging the forwarded principal with a
+// Grpc-Metadata-X-Forwarded-Principal header, which the gateway would otherwise
+// send to the backend ahead of the principal that it has actually authenticated.
+func dropForwardedPrincipal(key string) (string, bool) {
+	mdKey, ok := runtime.DefaultHeaderMatcher(key)
+	if ok && strings.EqualFold(mdKey, server.ForwardedPrincipalKey) {
+		return "", false
+	}
+	return mdKey, ok
+}
+
+func forwardPrincipal(ctx context.Context, _ *http.Request) metadata.MD {
+	principal := server.CurrentPrincipal(ctx)
+	if principal == nil {
+		return nil
 	}
-	cert, err := tls.LoadX509KeyPair("target/server.crt", "target/server.key")
+	value, err := server.EncodePrincipal(principal)
 	if err != nil {
-		return fmt.Errorf("failed to load cert & key files: %w", err)
+		// the backend will then reject the request
+		log.WithError(err).Warn("cannot forward principal")
+		return nil
 	}
-	// if we wanted to make mTLS mandatory we should
-	// set ClientAuth to tls.RequireAndVerifyClientCert
-	cfg := &tls.Config{
-		ClientAuth:   tls.VerifyClientCertIfGiven,
-		ClientCAs:    caCertPool,
-		Certificates: []tls.Certificate{cert},
+	return metadata.Pairs(server.ForwardedPrincipalKey, value)
+}
+
+func newMux(opts ...runtime.ServeMuxOption) *runtime.ServeMux {
+	// yes, we are matching all incoming input as JSON, but see note below
+	opts = append(opts, runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{}))
+	return runtime.NewServeMux(opts...)
+}
+
+func authzOption(authz server.Authorizer) runtime.ServeMuxOption {
+	if !authz.Enabled() {
+		return runtime.WithMiddlewares()
 	}
-	srv.TLSConfig = cfg
-	return nil
+	return runtime.WithMiddlewares(authzMiddleware(authz))
+}
+
+// NOTE: grpc-gateway does not play nice with anything other than JSON request bodies,
+// unless you want to do your own parsing from HttpBody instances, but it does not check
+// that the Content-Type is actually JSON, so let's enforce that a bit.
+func jsonOnly(httpMux *runtime.ServeMux) http.Handler {
+	return handlers.ContentTypeHandler(httpMux, "application/json")
 }
 
 func (s *service) ListenAndServe() error {
-	ll := log.WithField("port", s.port)
-	var err error
-	if s.mtls {
-		ll.Info("starting HTTPS server with mTLS")
-		// cert & key files provided during mTLS setup
-		err = s.server.ListenAndServeTLS("", "")
-	} else {
-		ll.Info("starting HTTPS server")
-		err = s.server.ListenAndServeTLS("target/server.crt", "target/server.key")
+	listeners, err := listen.ListenAll(s.addrs)
+	if err != nil {
+		return err
+	}
+	for _, lis := range listeners {
+		s.logStart(lis)
 	}
+	s.SetReady(listen.Addrs(listeners))
+	err = listen.Serve(listeners, s.serve)
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
 	return err
 }
 
-func (s *service) GracefulStop() {
-	// let's be nice, but not too nice
-	quiet.CloseWithTimeout(s.server.Shutdown, 100*time.Millisecond)
+func (s *service) logStart(lis net.Listener) {
+	ll := log.WithField("addr", lis.Addr())
+	if s.grpc != nil {
+		ll = ll.WithField("grpc", true)
+	}
+	switch {
+	case listen.IsUnix(lis):
+		ll.Info("starting HTTP server on unix socket")
+	case s.mtls != server.ClientAuthOff:
+		ll.WithField("client_auth", s.mtls).Info("starting HTTPS server with mTLS")
+	default:
+		ll.Info("starting HTTPS server")
+	}
+}
+
+func (s *service) serve(lis net.Listener) error {
+	if listen.IsUnix(lis) {
+		// local callers are identified by their peer credentials
+		return s.server.Serve(lis)
+	}
+	// cert & key files provided during TLS setup
+	return s.server.ServeTLS(lis, "", "")
+}
+
+func (s *service) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		// drop the connections that outlasted the context
+		s.server.Close()
+	}
+	if s.grpc != nil {
+		// close any gRPC streams that outlasted the shutdown
+		s.grpc.Stop()
+	}
+	return err
 }
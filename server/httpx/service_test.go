@@ -0,0 +1,220 @@
+package httpx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/server"
+)
+
+type recordingBackend struct {
+	api.UnimplementedExampleServer
+	mu        sync.Mutex
+	forwarded []string
+}
+
+func (b *recordingBackend) Echo(ctx context.Context, req *api.EchoRequest) (*api.EchoResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.forwarded = metadata.ValueFromIncomingContext(ctx, server.ForwardedPrincipalKey)
+	return &api.EchoResponse{Message: req.Message}, nil
+}
+
+func TestProxyHandlerDropsForgedPrincipal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverTLS, clientTLS := testTLS(t)
+	backend := &recordingBackend{}
+	grpcSrv := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	api.RegisterExampleServer(grpcSrv, backend)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go grpcSrv.Serve(lis)
+	defer grpcSrv.Stop()
+
+	proxy, err := proxyHandler(ctx, Backend{Addr: lis.Addr().String(), TLS: clientTLS}, &server.Policy{DefaultAllow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stands in for the auth middleware
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := &server.Principal{Name: "alice", Method: server.AuthMethodToken}
+		proxy.ServeHTTP(w, r.WithContext(server.WithPrincipal(r.Context(), principal)))
+	})
+
+	forged, err := server.EncodePrincipal(&server.Principal{Name: "admin", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/example/echo", strings.NewReader(`{"message": "hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Grpc-Metadata-X-Forwarded-Principal", forged)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if len(backend.forwarded) != 1 {
+		t.Fatalf("expected one forwarded principal, got %d", len(backend.forwarded))
+	}
+	principal, err := server.DecodePrincipal(backend.forwarded[0], &server.Principal{Name: "gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != "alice" || len(principal.Roles) != 0 {
+		t.Errorf("expected alice without roles, got %s with %v", principal.Name, principal.Roles)
+	}
+}
+
+func TestHTTPHandlerAuthorizesRoutes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// everything is allowed, except for the echo route
+	policy := &server.Policy{
+		DefaultAllow: true,
+		Rules: []server.PolicyRule{{
+			Resources: []string{"POST /v1/example/echo"},
+			Users:     []string{"alice"},
+		}},
+	}
+	gateway, err := httpHandler(ctx, &recordingBackend{}, nil, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		override string
+		want     int
+	}{
+		{name: "allowed", user: "alice", method: http.MethodPost, path: "/v1/example/echo", want: http.StatusOK},
+		{name: "denied", user: "bob", method: http.MethodPost, path: "/v1/example/echo", want: http.StatusForbidden},
+		{name: "escaped letter", user: "bob", method: http.MethodPost, path: "/v1/%65xample/echo", want: http.StatusForbidden},
+		{name: "escaped slash", user: "bob", method: http.MethodPost, path: "/v1/example%2Fecho", want: http.StatusForbidden},
+		{name: "double slash", user: "bob", method: http.MethodPost, path: "/v1//example/echo", want: http.StatusNotFound},
+		{name: "trailing slash", user: "bob", method: http.MethodPost, path: "/v1/example/echo/", want: http.StatusNotFound},
+		{name: "method override", user: "bob", method: http.MethodPost, path: "/v1/example/echo", override: http.MethodGet, want: http.StatusForbidden},
+		{name: "other method", user: "bob", method: http.MethodGet, path: "/v1/example/echo", want: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"message": "hello"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.override != "" {
+				req.Header.Set("X-HTTP-Method-Override", tt.override)
+			}
+			principal := &server.Principal{Name: tt.user, Method: server.AuthMethodToken}
+			req = req.WithContext(server.WithPrincipal(req.Context(), principal))
+			res := httptest.NewRecorder()
+			gateway.ServeHTTP(res, req)
+			if res.Code != tt.want {
+				t.Errorf("%s %s: got %d, want %d: %s", tt.method, tt.path, res.Code, tt.want, res.Body)
+			}
+		})
+	}
+}
+
+func TestH2CHandler(t *testing.T) {
+	handler := h2cHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	// HTTP/2 with prior knowledge, the way gRPC clients talk to plaintext servers
+	h2 := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	tests := []struct {
+		name   string
+		client *http.Client
+		want   string
+	}{
+		{name: "http/1.1", client: srv.Client(), want: "HTTP/1.1"},
+		{name: "h2c", client: h2, want: "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("got %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+// testTLS creates a self-signed localhost certificate for the backend.
+func testTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	serverTLS := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h2"},
+	}
+	clientTLS := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	return serverTLS, clientTLS
+}
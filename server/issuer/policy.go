@@ -0,0 +1,86 @@
+package issuer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// NamePolicy decides which certificate names each caller may request.
+type NamePolicy struct {
+	Rules []NameRule `yaml:"rules"`
+}
+
+// NameRule lets the matching users, or callers with any of the roles,
+// request certificates for names that match any of its glob patterns.
+// A user of "*" matches every authenticated caller.
+type NameRule struct {
+	Users []string `yaml:"users"`
+	Roles []string `yaml:"roles"`
+	// Names are glob patterns, such as "*.dev.example.com", where "{user}"
+	// stands for the caller's username (e.g. "{user}" or "*.{user}").
+	Names []string `yaml:"names"`
+}
+
+// LoadNamePolicy reads a YAML or JSON name policy file.
+func LoadNamePolicy(policyFile string) (*NamePolicy, error) {
+	buf, err := os.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read name policy: %w", err)
+	}
+	policy := &NamePolicy{}
+	if err = yaml.Unmarshal(buf, policy); err != nil {
+		return nil, fmt.Errorf("cannot parse name policy: %w", err)
+	}
+	for _, rule := range policy.Rules {
+		for _, pattern := range rule.Names {
+			if _, err = path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("bad name pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Allow reports whether the principal may request a certificate for the name.
+func (p *NamePolicy) Allow(principal *server.Principal, name string) bool {
+	// "*" in a name would match its own pattern, and wildcard certificates
+	// would cover names that the policy does not allow
+	if principal == nil || strings.Contains(name, "*") {
+		return false
+	}
+	// a username is a literal, not a pattern that could match other names
+	user := globEscaper.Replace(principal.Name)
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(principal) {
+			continue
+		}
+		for _, pattern := range rule.Names {
+			pattern = strings.ReplaceAll(pattern, "{user}", user)
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r NameRule) appliesTo(principal *server.Principal) bool {
+	if slices.Contains(r.Users, "*") || slices.Contains(r.Users, principal.Name) {
+		return true
+	}
+	for _, role := range r.Roles {
+		if principal.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
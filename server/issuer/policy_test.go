@@ -0,0 +1,47 @@
+package issuer
+
+import (
+	"testing"
+
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestNamePolicyAllow(t *testing.T) {
+	policy := &NamePolicy{Rules: []NameRule{
+		{Users: []string{"*"}, Names: []string{"{user}.users.example.com"}},
+		{Users: []string{"alice"}, Names: []string{"*.dev.example.com"}},
+		{Roles: []string{"deployer"}, Names: []string{"*.{user}.svc.example.com", "spiffe://example.org/{user}/*"}},
+	}}
+	alice := &server.Principal{Name: "alice"}
+	bob := &server.Principal{Name: "bob", Roles: []string{"deployer"}}
+	tests := []struct {
+		name      string
+		principal *server.Principal
+		cert      string
+		want      bool
+	}{
+		{name: "no principal", principal: nil, cert: "alice.users.example.com", want: false},
+		{name: "any user, own name", principal: alice, cert: "alice.users.example.com", want: true},
+		{name: "any user, other name", principal: alice, cert: "bob.users.example.com", want: false},
+		{name: "named user", principal: alice, cert: "api.dev.example.com", want: true},
+		{name: "other user", principal: bob, cert: "api.dev.example.com", want: false},
+		{name: "role with user glob", principal: bob, cert: "api.bob.svc.example.com", want: true},
+		{name: "role, other user", principal: bob, cert: "api.alice.svc.example.com", want: false},
+		{name: "role without grant", principal: alice, cert: "api.alice.svc.example.com", want: false},
+		{name: "uri", principal: bob, cert: "spiffe://example.org/bob/worker", want: true},
+		{name: "glob star in username", principal: &server.Principal{Name: "*"}, cert: "bob.users.example.com", want: false},
+		{name: "literal star username", principal: &server.Principal{Name: "*"}, cert: "*.users.example.com", want: false},
+		{name: "glob question mark in username", principal: &server.Principal{Name: "bo?"}, cert: "bob.users.example.com", want: false},
+		{name: "glob class in username", principal: &server.Principal{Name: "[a-z]ob"}, cert: "bob.users.example.com", want: false},
+		{name: "escape in username", principal: &server.Principal{Name: `\*`}, cert: `\*.users.example.com`, want: false},
+		{name: "escape in username, star", principal: &server.Principal{Name: `\*`}, cert: "*.users.example.com", want: false},
+		{name: "user glob in role pattern", principal: &server.Principal{Name: "*", Roles: []string{"deployer"}}, cert: "api.bob.svc.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allow(tt.principal, tt.cert); got != tt.want {
+				t.Fatalf("Allow(%v, %q): got %v, want %v", tt.principal, tt.cert, got, tt.want)
+			}
+		})
+	}
+}
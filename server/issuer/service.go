@@ -0,0 +1,213 @@
+package issuer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/server"
+	"github.com/tomcz/example-grpc/tlsconfig"
+)
+
+// Config describes the CA that signs certificates, and what it may sign.
+type Config struct {
+	// CertFile holds the CA's certificate, followed by any intermediate CAs above it.
+	CertFile string
+	KeyFile  string
+	// Passphrase decrypts an encrypted KeyFile.
+	Passphrase []byte
+	// MaxValidity caps the lifetime of issued certificates.
+	MaxValidity time.Duration
+	Policy      *NamePolicy
+	// ClientCAs are trusted for client authentication. The issuing CA must not
+	// chain to them, or callers could issue themselves new client credentials.
+	ClientCAs []*x509.Certificate
+}
+
+type issuerServer struct {
+	api.UnimplementedIssuerServer
+	cert        *x509.Certificate
+	key         crypto.Signer
+	chain       []byte
+	maxValidity time.Duration
+	policy      *NamePolicy
+}
+
+// NewIssuerServer signs certificate signing requests from authenticated
+// callers, for the names that the policy allows them to request.
+func NewIssuerServer(cfg Config) (api.IssuerServer, error) {
+	if cfg.MaxValidity <= 0 {
+		return nil, fmt.Errorf("a maximum certificate lifetime is required")
+	}
+	if cfg.Policy == nil {
+		return nil, fmt.Errorf("a name policy is required")
+	}
+	pair, err := tlsconfig.LoadKeyPair(cfg.CertFile, cfg.KeyFile, cfg.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load issuing CA: %w", err)
+	}
+	if !pair.Leaf.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", cfg.CertFile)
+	}
+	if err = checkNotTrusted(pair, cfg.ClientCAs); err != nil {
+		return nil, fmt.Errorf("cannot use %s as the issuing CA: %w", cfg.CertFile, err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("issuing CA key cannot sign certificates")
+	}
+	s := &issuerServer{
+		cert:        pair.Leaf,
+		key:         signer,
+		maxValidity: cfg.MaxValidity,
+		policy:      cfg.Policy,
+	}
+	// clients already have the root CA, but not the intermediates
+	if !bytes.Equal(pair.Leaf.RawIssuer, pair.Leaf.RawSubject) {
+		for _, der := range pair.Certificate {
+			s.chain = append(s.chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		}
+	}
+	return s, nil
+}
+
+func (s *issuerServer) IssueCertificate(ctx context.Context, in *api.IssueCertificateRequest) (*api.IssueCertificateResponse, error) {
+	principal := server.CurrentPrincipal(ctx)
+	if principal == nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	block, _ := pem.Decode([]byte(in.Csr))
+	if block == nil || !strings.HasSuffix(block.Type, "CERTIFICATE REQUEST") {
+		return nil, status.Error(codes.InvalidArgument, "csr must be a PEM-encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad csr: %v", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad csr signature: %v", err)
+	}
+	names := requestedNames(csr)
+	if len(names) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "csr must request at least one name")
+	}
+	for _, name := range names {
+		if strings.Contains(name, "*") {
+			return nil, status.Errorf(codes.InvalidArgument, "wildcard names are not allowed: %q", name)
+		}
+	}
+	for _, name := range names {
+		if !s.policy.Allow(principal, name) {
+			log.WithField("user", principal.Name).WithField("name", name).Warn("certificate name not allowed")
+			return nil, status.Errorf(codes.PermissionDenied, "not allowed to request a certificate for %q", name)
+		}
+	}
+	validity := s.maxValidity
+	if in.Validity != nil && in.Validity.AsDuration() > 0 && in.Validity.AsDuration() < validity {
+		validity = in.Validity.AsDuration()
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, issueFailed(fmt.Errorf("cannot generate serial number: %w", err))
+	}
+	// certificates only have second precision
+	now := time.Now().Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		// only copy the parts of the request that the policy has checked
+		Subject:        pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+		EmailAddresses: csr.EmailAddresses,
+		NotBefore:      now,
+		NotAfter:       now.Add(validity),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if tmpl.NotAfter.After(s.cert.NotAfter) {
+		tmpl.NotAfter = s.cert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.cert, csr.PublicKey, s.key)
+	if err != nil {
+		return nil, issueFailed(fmt.Errorf("cannot sign certificate: %w", err))
+	}
+	log.WithField("user", principal.Name).
+		WithField("serial", fmt.Sprintf("%x", serial)).
+		WithField("names", names).
+		WithField("not_after", tmpl.NotAfter).
+		Info("issued certificate")
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &api.IssueCertificateResponse{
+		CertificateChain: string(append(chain, s.chain...)),
+		SerialNumber:     fmt.Sprintf("%x", serial),
+		NotAfter:         timestamppb.New(tmpl.NotAfter),
+	}, nil
+}
+
+func checkNotTrusted(pair tls.Certificate, clientCAs []*x509.Certificate) error {
+	if len(clientCAs) == 0 {
+		return nil
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range clientCAs {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range pair.Certificate[1:] {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		intermediates.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := pair.Leaf.Verify(opts); err == nil {
+		return fmt.Errorf("it is trusted for client certificates")
+	}
+	return nil
+}
+
+func issueFailed(err error) error {
+	errorID := server.ErrorID()
+	log.WithError(err).WithField("error_id", errorID).Error("certificate issue failed")
+	return status.Errorf(codes.Internal, "error_id: %s", errorID)
+}
+
+func requestedNames(csr *x509.CertificateRequest) []string {
+	var names []string
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
+	}
+	names = append(names, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, csr.EmailAddresses...)
+	// the common name is usually repeated as a SAN
+	slices.Sort(names)
+	return slices.Compact(names)
+}
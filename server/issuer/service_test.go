@@ -0,0 +1,280 @@
+package issuer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	caNotAfter := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	issuer := newTestIssuer(t, caNotAfter, time.Hour)
+	ctx := server.WithPrincipal(context.Background(), &server.Principal{Name: "alice"})
+
+	t.Run("user substitution", func(t *testing.T) {
+		cert := issue(t, issuer, ctx, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "alice.users.example.com"},
+			DNSNames: []string{"alice.users.example.com"},
+		}, 0)
+		if cert.Subject.CommonName != "alice.users.example.com" {
+			t.Fatalf("unexpected CN: %s", cert.Subject.CommonName)
+		}
+		_, err := issueErr(t, issuer, ctx, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "bob.users.example.com"},
+		}, 0)
+		expectCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("every name is checked", func(t *testing.T) {
+		for name, csr := range map[string]*x509.CertificateRequest{
+			"dns": {
+				Subject:  pkix.Name{CommonName: "alice.users.example.com"},
+				DNSNames: []string{"alice.users.example.com", "bob.users.example.com"},
+			},
+			"ip": {
+				Subject:     pkix.Name{CommonName: "alice.users.example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.2")},
+			},
+			"uri": {
+				Subject: pkix.Name{CommonName: "alice.users.example.com"},
+				URIs:    []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/bob"}},
+			},
+			"email": {
+				Subject:        pkix.Name{CommonName: "alice.users.example.com"},
+				EmailAddresses: []string{"bob@example.com"},
+			},
+			"san only": {
+				DNSNames: []string{"bob.users.example.com"},
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := issueErr(t, issuer, ctx, csr, 0)
+				expectCode(t, err, codes.PermissionDenied)
+			})
+		}
+		cert := issue(t, issuer, ctx, &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "alice.users.example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/alice"}},
+			EmailAddresses: []string{"alice@example.com"},
+		}, 0)
+		if len(cert.IPAddresses) != 1 || len(cert.URIs) != 1 || len(cert.EmailAddresses) != 1 {
+			t.Fatalf("missing SANs: %v %v %v", cert.IPAddresses, cert.URIs, cert.EmailAddresses)
+		}
+	})
+
+	t.Run("only the common name is copied", func(t *testing.T) {
+		cert := issue(t, issuer, ctx, &x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName:         "alice.users.example.com",
+				Organization:       []string{"example admins"},
+				OrganizationalUnit: []string{"engineering"},
+			},
+		}, 0)
+		want := pkix.Name{CommonName: "alice.users.example.com"}
+		if cert.Subject.String() != want.String() {
+			t.Fatalf("got subject %s, want %s", cert.Subject, want)
+		}
+	})
+
+	t.Run("validity", func(t *testing.T) {
+		csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "alice.users.example.com"}}
+		cert := issue(t, issuer, ctx, csr, 10*time.Minute)
+		expectValidity(t, cert, 10*time.Minute)
+		cert = issue(t, issuer, ctx, csr, 0)
+		expectValidity(t, cert, time.Hour)
+		cert = issue(t, issuer, ctx, csr, 10*time.Hour)
+		expectValidity(t, cert, time.Hour)
+	})
+
+	t.Run("clamped to CA expiry", func(t *testing.T) {
+		shortCA := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+		issuer := newTestIssuer(t, shortCA, time.Hour)
+		cert := issue(t, issuer, ctx, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "alice.users.example.com"},
+		}, 0)
+		if !cert.NotAfter.Equal(shortCA) {
+			t.Fatalf("got not after %s, want CA expiry %s", cert.NotAfter, shortCA)
+		}
+	})
+
+	t.Run("wildcard names", func(t *testing.T) {
+		ctx := server.WithPrincipal(context.Background(), &server.Principal{Name: "*"})
+		for name, csr := range map[string]*x509.CertificateRequest{
+			"cn":  {Subject: pkix.Name{CommonName: "*.users.example.com"}},
+			"dns": {DNSNames: []string{"*.users.example.com"}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := issueErr(t, issuer, ctx, csr, 0)
+				expectCode(t, err, codes.InvalidArgument)
+			})
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := issueErr(t, issuer, context.Background(), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "alice.users.example.com"},
+		}, 0)
+		expectCode(t, err, codes.Unauthenticated)
+	})
+}
+
+func TestNewIssuerServerTrustedCA(t *testing.T) {
+	certFile, keyFile, ca := newTestCA(t, time.Now().Add(time.Hour))
+	_, _, otherCA := newTestCA(t, time.Now().Add(time.Hour))
+
+	_, err := NewIssuerServer(Config{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		MaxValidity: time.Hour,
+		Policy:      &NamePolicy{},
+		ClientCAs:   []*x509.Certificate{otherCA, ca},
+	})
+	if err == nil {
+		t.Fatal("expected a CA trusted for client certificates to be refused")
+	}
+
+	_, err = NewIssuerServer(Config{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		MaxValidity: time.Hour,
+		Policy:      &NamePolicy{},
+		ClientCAs:   []*x509.Certificate{otherCA},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestIssuer(t *testing.T, notAfter time.Time, maxValidity time.Duration) api.IssuerServer {
+	t.Helper()
+	certFile, keyFile, _ := newTestCA(t, notAfter)
+	issuer, err := NewIssuerServer(Config{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		MaxValidity: maxValidity,
+		Policy: &NamePolicy{Rules: []NameRule{{
+			Users: []string{"*"},
+			Names: []string{"{user}.users.example.com", "10.0.0.1", "spiffe://example.org/{user}", "{user}@example.com"},
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func newTestCA(t *testing.T, notAfter time.Time) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test issuing ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca.crt")
+	keyFile := filepath.Join(dir, "ca.key")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func issue(t *testing.T, issuer api.IssuerServer, ctx context.Context, csr *x509.CertificateRequest, validity time.Duration) *x509.Certificate {
+	t.Helper()
+	cert, err := issueErr(t, issuer, ctx, csr, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func issueErr(t *testing.T, issuer api.IssuerServer, ctx context.Context, csr *x509.CertificateRequest, validity time.Duration) (*x509.Certificate, error) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, csr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &api.IssueCertificateRequest{
+		Csr: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+	}
+	if validity > 0 {
+		req.Validity = durationpb.New(validity)
+	}
+	res, err := issuer.IssueCertificate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(res.CertificateChain))
+	if block == nil {
+		t.Fatal("no certificate in response")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth) {
+		t.Fatalf("certificate cannot be used for client auth: %v", cert.ExtKeyUsage)
+	}
+	return cert, nil
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
+
+func expectValidity(t *testing.T, cert *x509.Certificate, validity time.Duration) {
+	t.Helper()
+	if got := cert.NotAfter.Sub(cert.NotBefore); got != validity {
+		t.Fatalf("got validity %s, want %s", got, validity)
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnknownKey authentication failure
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// don't hammer the key server when tokens arrive with unknown key IDs
+const minUnknownKidRefresh = 10 * time.Second
+
+// KeySet resolves JWT verification keys by their "kid" header.
+type KeySet interface {
+	Key(kid string) (any, error)
+}
+
+type jwksKeySet struct {
+	location string
+	client   *http.Client
+	refresh  time.Duration
+
+	fetchLock   sync.Mutex
+	lastAttempt time.Time
+
+	keysLock sync.RWMutex
+	keys     map[string]any
+}
+
+// NewJWKS creates a KeySet from a JSON Web Key Set held in a local file or
+// served from an HTTP(S) URL. The key set is reloaded in the background every
+// refresh interval, or sooner when a token refers to an unknown key, and the last
+// good key set keeps being used when a reload fails. A nil client uses a default one.
+func NewJWKS(ctx context.Context, location string, refresh time.Duration, client *http.Client) (KeySet, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	ks := &jwksKeySet{
+		location: location,
+		client:   client,
+		refresh:  refresh,
+	}
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+	if refresh > 0 {
+		go ks.refreshLoop(ctx)
+	}
+	return ks, nil
+}
+
+func (k *jwksKeySet) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(k.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			k.reloadIfStale(k.refresh)
+		}
+	}
+}
+
+func (k *jwksKeySet) Key(kid string) (any, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	k.reloadIfStale(minUnknownKidRefresh)
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+}
+
+func (k *jwksKeySet) lookup(kid string) (any, bool) {
+	k.keysLock.RLock()
+	defer k.keysLock.RUnlock()
+	if kid == "" && len(k.keys) == 1 {
+		// tokens without a kid are fine when there is no ambiguity
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// reloadIfStale checks staleness while holding the fetch lock, so that
+// requests queued behind a reload do not each fetch the key set again.
+func (k *jwksKeySet) reloadIfStale(interval time.Duration) {
+	k.fetchLock.Lock()
+	defer k.fetchLock.Unlock()
+	if time.Since(k.lastAttempt) < interval {
+		return
+	}
+	if err := k.reloadLocked(); err != nil {
+		log.WithError(err).WithField("jwks", k.location).Warn("JWKS refresh failed, using last good key set")
+	}
+}
+
+func (k *jwksKeySet) reload() error {
+	k.fetchLock.Lock()
+	defer k.fetchLock.Unlock()
+	return k.reloadLocked()
+}
+
+func (k *jwksKeySet) reloadLocked() error {
+	k.lastAttempt = time.Now()
+	buf, err := k.fetch()
+	if err != nil {
+		return fmt.Errorf("cannot load JWKS: %w", err)
+	}
+	keys, err := parseJWKS(buf)
+	if err != nil {
+		return fmt.Errorf("cannot parse JWKS: %w", err)
+	}
+	k.keysLock.Lock()
+	k.keys = keys
+	k.keysLock.Unlock()
+	return nil
+}
+
+func (k *jwksKeySet) fetch() ([]byte, error) {
+	if !strings.HasPrefix(k.location, "http://") && !strings.HasPrefix(k.location, "https://") {
+		return os.ReadFile(strings.TrimPrefix(k.location, "file://"))
+	}
+	res, err := k.client.Get(k.location)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(buf []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("kid %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+	return keys, nil
+}
+
+func (j jsonWebKey) publicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(j.K)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", j.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
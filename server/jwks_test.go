@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type jwksStub struct {
+	kid     atomic.Value
+	fetches atomic.Int32
+	slow    atomic.Bool
+	block   chan struct{}
+}
+
+func (s *jwksStub) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.fetches.Add(1)
+	if s.slow.Load() {
+		<-s.block
+	}
+	fmt.Fprintf(w, `{"keys": [{"kty": "oct", "kid": %q, "k": "c2VjcmV0"}]}`, s.kid.Load())
+}
+
+func TestJWKSUnknownKidFetchesOnce(t *testing.T) {
+	stub := &jwksStub{}
+	stub.kid.Store("a")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ks, err := NewJWKS(context.Background(), srv.URL, 0, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.Key("b"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+	if n := stub.fetches.Load(); n != 1 {
+		t.Fatalf("expected no refetch within %s, got %d fetches", minUnknownKidRefresh, n)
+	}
+
+	// rotate the keys, as if the last fetch was a while ago
+	stub.kid.Store("b")
+	jwks := ks.(*jwksKeySet)
+	jwks.fetchLock.Lock()
+	jwks.lastAttempt = time.Now().Add(-time.Minute)
+	jwks.fetchLock.Unlock()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Key("b"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := stub.fetches.Load(); n != 2 {
+		t.Errorf("expected concurrent requests to share one refetch, got %d fetches in total", n)
+	}
+}
+
+func TestJWKSRefreshesInBackground(t *testing.T) {
+	stub := &jwksStub{block: make(chan struct{})}
+	stub.kid.Store("a")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ks, err := NewJWKS(ctx, srv.URL, 10*time.Millisecond, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a slow key server must not hold up requests for known keys
+	stub.slow.Store(true)
+	defer close(stub.block)
+	deadline := time.Now().Add(time.Second)
+	for stub.fetches.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("no background refresh")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ks.Key("a")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("known key lookup waited for the refresh")
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig describes how bearer JWTs are validated.
+type JWTConfig struct {
+	// Algorithms that tokens may be signed with (e.g. HS256, RS256, ES256).
+	Algorithms []string
+	// Key verifies token signatures: a []byte secret for HMAC,
+	// or an *rsa.PublicKey / *ecdsa.PublicKey for RSA & ECDSA.
+	Key any
+	// Keys resolves verification keys using the token's "kid" header,
+	// and is used instead of Key when the signing keys are rotated.
+	Keys KeySet
+	// Issuer, when set, must match the "iss" claim.
+	Issuer string
+	// Audience, when set, must be present in the "aud" claim.
+	Audience string
+	// UsernameClaim names the claim that holds the username; defaults to "sub".
+	UsernameClaim string
+	// RolesClaim names the claim that holds the caller's roles; defaults to "roles".
+	RolesClaim string
+	// Leeway allows for clock skew when checking exp, nbf & iat.
+	Leeway time.Duration
+}
+
+type jwtAuth struct {
+	parser *jwt.Parser
+	key    any
+	keys   KeySet
+	claim  string
+	roles  string
+}
+
+// NewJWTAuth represents bearer token authentication using signed JWTs.
+func NewJWTAuth(cfg JWTConfig) (TokenAuth, error) {
+	if len(cfg.Algorithms) == 0 {
+		return nil, fmt.Errorf("at least one JWT algorithm is required")
+	}
+	if cfg.Key == nil && cfg.Keys == nil {
+		return nil, fmt.Errorf("a JWT verification key or key set is required")
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	claim := cfg.UsernameClaim
+	if claim == "" {
+		claim = "sub"
+	}
+	roles := cfg.RolesClaim
+	if roles == "" {
+		roles = "roles"
+	}
+	return &jwtAuth{
+		parser: jwt.NewParser(opts...),
+		key:    cfg.Key,
+		keys:   cfg.Keys,
+		claim:  claim,
+		roles:  roles,
+	}, nil
+}
+
+func (j *jwtAuth) Scheme() string {
+	return "bearer"
+}
+
+func (j *jwtAuth) Authenticate(token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := j.parser.ParseWithClaims(token, claims, j.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	username, ok := claims[j.claim].(string)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: missing %q claim", ErrInvalidToken, j.claim)
+	}
+	principal := &Principal{
+		Name:       username,
+		Method:     AuthMethodToken,
+		Roles:      claimStrings(claims[j.roles]),
+		Attributes: map[string]string{},
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		principal.TokenID = jti
+	}
+	if iss, err := claims.GetIssuer(); err == nil && iss != "" {
+		principal.Attributes["issuer"] = iss
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		principal.Expiry = exp.Time
+	}
+	return principal, nil
+}
+
+// claimStrings accepts both a single string and a list of strings,
+// since identity providers disagree on how to encode multi-valued claims.
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var res []string
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				res = append(res, str)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+func (j *jwtAuth) keyFunc(token *jwt.Token) (any, error) {
+	if j.keys == nil {
+		return j.key, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	return j.keys.Key(kid)
+}
+
+// LoadJWTKey reads a JWT verification key suitable for the given algorithm.
+// HMAC algorithms use the file's contents as the shared secret, while
+// RSA & ECDSA algorithms expect a PEM-encoded public key or certificate.
+func LoadJWTKey(alg, keyFile string) (any, error) {
+	buf, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read JWT key: %w", err)
+	}
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		secret := []byte(strings.TrimSpace(string(buf)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("empty JWT secret in %s", keyFile)
+		}
+		return secret, nil
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "ES"):
+		return parsePublicKeyPEM(buf)
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", alg)
+	}
+}
+
+func parsePublicKeyPEM(buf []byte) (any, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block: %s", block.Type)
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	secret := []byte("secret")
+
+	hsAuth, err := NewJWTAuth(JWTConfig{
+		Algorithms: []string{"HS256"},
+		Key:        secret,
+		Issuer:     "https://idp.example.com",
+		Audience:   "example-grpc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsAuth, err := NewJWTAuth(JWTConfig{
+		Algorithms: []string{"RS256"},
+		Key:        &rsaKey.PublicKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "alice",
+			"iss": "https://idp.example.com",
+			"aud": "example-grpc",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims, key any) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		auth  TokenAuth
+		token string
+		valid bool
+		roles []string
+	}{
+		{name: "valid", auth: hsAuth, token: sign(jwt.SigningMethodHS256, valid(), secret), valid: true},
+		{name: "valid RSA", auth: rsAuth, token: sign(jwt.SigningMethodRS256, valid(), rsaKey), valid: true},
+		{name: "role list", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("roles", []string{"a", "b"}), secret), valid: true, roles: []string{"a", "b"}},
+		{name: "role string", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("roles", "a b"), secret), valid: true, roles: []string{"a", "b"}},
+		{name: "wrong secret", auth: hsAuth, token: sign(jwt.SigningMethodHS256, valid(), []byte("wrong")), valid: false},
+		{name: "alg none", auth: hsAuth, token: sign(jwt.SigningMethodNone, valid(), jwt.UnsafeAllowNoneSignatureType), valid: false},
+		{name: "HMAC with the RSA public key", auth: rsAuth, token: sign(jwt.SigningMethodHS256, valid(), pubPEM), valid: false},
+		{name: "HMAC with the RSA public key DER", auth: rsAuth, token: sign(jwt.SigningMethodHS256, valid(), pubDER), valid: false},
+		{name: "unexpected HS384", auth: hsAuth, token: sign(jwt.SigningMethodHS384, valid(), secret), valid: false},
+		{name: "missing exp", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("exp", nil), secret), valid: false},
+		{name: "expired", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("exp", time.Now().Add(-time.Minute).Unix()), secret), valid: false},
+		{name: "not yet valid", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("nbf", time.Now().Add(time.Hour).Unix()), secret), valid: false},
+		{name: "missing aud", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("aud", nil), secret), valid: false},
+		{name: "wrong aud", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("aud", "other"), secret), valid: false},
+		{name: "aud list", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("aud", []string{"other", "example-grpc"}), secret), valid: true},
+		{name: "missing iss", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("iss", nil), secret), valid: false},
+		{name: "wrong iss", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("iss", "https://evil.example.com"), secret), valid: false},
+		{name: "missing sub", auth: hsAuth, token: sign(jwt.SigningMethodHS256, with("sub", nil), secret), valid: false},
+		{name: "not a JWT", auth: hsAuth, token: "wibble", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := tt.auth.Authenticate(tt.token)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("expected an invalid token, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.Name != "alice" || principal.Method != AuthMethodToken {
+				t.Errorf("unexpected principal: %+v", principal)
+			}
+			if !slices.Equal(principal.Roles, tt.roles) {
+				t.Errorf("got roles %v, want %v", principal.Roles, tt.roles)
+			}
+		})
+	}
+}
+
+func TestJWTAuthRefreshesJWKSForNewKid(t *testing.T) {
+	stub := &jwksStub{}
+	stub.kid.Store("a")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ks, err := NewJWKS(context.Background(), srv.URL, 0, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewJWTAuth(JWTConfig{Algorithms: []string{"HS256"}, Keys: ks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "alice",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if _, err = auth.Authenticate(sign("a")); err != nil {
+		t.Fatal(err)
+	}
+	// the identity provider rotates its keys, and the last fetch was a while ago
+	stub.kid.Store("b")
+	jwks := ks.(*jwksKeySet)
+	jwks.fetchLock.Lock()
+	jwks.lastAttempt = time.Now().Add(-time.Minute)
+	jwks.fetchLock.Unlock()
+
+	if _, err = auth.Authenticate(sign("b")); err != nil {
+		t.Fatalf("expected the new kid to be fetched: %v", err)
+	}
+	if _, err = auth.Authenticate(sign("a")); !errors.Is(err, ErrInvalidToken) || !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected the rotated out kid to be unknown, got %v", err)
+	}
+	if n := stub.fetches.Load(); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+}
+
+func TestLoadJWTKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name string, buf []byte) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, buf, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	secretFile := write("secret", []byte("secret\n"))
+	emptyFile := write("empty", []byte("\n"))
+	pubFile := write("pub.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	pkcs1File := write("rsa.pem", pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}))
+
+	tests := []struct {
+		name    string
+		alg     string
+		file    string
+		wantErr bool
+	}{
+		{name: "HMAC secret", alg: "HS256", file: secretFile},
+		{name: "empty secret", alg: "HS256", file: emptyFile, wantErr: true},
+		{name: "PKIX public key", alg: "RS256", file: pubFile},
+		{name: "PKCS1 public key", alg: "RS256", file: pkcs1File},
+		{name: "not PEM", alg: "RS256", file: secretFile, wantErr: true},
+		{name: "unsupported alg", alg: "PS256", file: pubFile, wantErr: true},
+		{name: "missing file", alg: "HS256", file: filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadJWTKey(tt.alg, tt.file)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %T", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret, ok := key.([]byte); ok && string(secret) != "secret" {
+				t.Errorf("secret was not trimmed: %q", secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package listen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tomcz/gotools/errgroup"
+)
+
+const (
+	unixScheme    = "unix://"
+	systemdScheme = "systemd://"
+	loopbackHost  = "loopback"
+)
+
+// Listen opens a listener on the address, which can be:
+//   - a port number, to listen on every interface with IPv4 & IPv6;
+//   - a TCP "host:port" address, where IPv4 addresses such as "0.0.0.0:8443"
+//     only listen with IPv4, and IPv6 addresses such as "[::]:8443" only with IPv6;
+//   - "unix:///path/to/socket" for a unix domain socket;
+//   - "systemd://name" to adopt the named socket that systemd passed in via
+//     LISTEN_FDS, or just "systemd://" to adopt the next unused socket.
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixScheme):
+		return listenUnix(strings.TrimPrefix(addr, unixScheme))
+	case strings.HasPrefix(addr, systemdScheme):
+		return activated(strings.TrimPrefix(addr, systemdScheme))
+	}
+	if _, err := strconv.Atoi(addr); err == nil {
+		addr = ":" + addr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	network := "tcp"
+	if ip := net.ParseIP(host); ip != nil {
+		// go listens with both IPv4 & IPv6 on "tcp" wildcard addresses
+		if ip.To4() != nil {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// ListenAll opens listeners on all the addresses, which can also be "loopback:port"
+// to listen on every loopback address, so that a listener is only reachable locally.
+// It closes the listeners that it opened when any of them fail.
+func ListenAll(addrs []string) ([]net.Listener, error) {
+	addrs, err := expand(addrs)
+	if err != nil {
+		return nil, err
+	}
+	var res []net.Listener
+	for _, addr := range addrs {
+		lis, err := Listen(addr)
+		if err != nil {
+			for _, opened := range res {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("cannot listen on %s: %w", addr, err)
+		}
+		res = append(res, lis)
+	}
+	return res, nil
+}
+
+// Serve serves every listener, and closes all of them as soon as one
+// fails, so that the service stops rather than carrying on half-open.
+func Serve(listeners []net.Listener, serve func(net.Listener) error) error {
+	group, ctx := errgroup.NewContext(context.Background())
+	for _, lis := range listeners {
+		group.Go(func() error {
+			return serve(lis)
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}()
+	return group.Wait()
+}
+
+// Addrs returns the addresses that the listeners are bound to,
+// which shows the actual port when port 0 was requested.
+func Addrs(listeners []net.Listener) []net.Addr {
+	res := make([]net.Addr, len(listeners))
+	for i, lis := range listeners {
+		res[i] = lis.Addr()
+	}
+	return res
+}
+
+func expand(addrs []string) ([]string, error) {
+	var res []string
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host != loopbackHost {
+			res = append(res, addr)
+			continue
+		}
+		loopback, err := loopbackIPs()
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range loopback {
+			res = append(res, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	return res, nil
+}
+
+// loopbackIPs returns 127.0.0.1 and ::1, or whichever of them this host has.
+func loopbackIPs() ([]net.IP, error) {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find loopback addresses: %w", err)
+	}
+	var res []net.IP
+	for _, ip := range []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback} {
+		for _, ifaceAddr := range ifaceAddrs {
+			if ipNet, ok := ifaceAddr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				res = append(res, ip)
+				break
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no loopback addresses found")
+	}
+	return res, nil
+}
+
+// IsUnix returns true for unix domain socket listeners.
+func IsUnix(lis net.Listener) bool {
+	_, ok := lis.(*net.UnixListener)
+	return ok
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix listener needs a socket path")
+	}
+	// remove a socket left behind by a previous run, but nothing else
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket: %w", err)
+		}
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,115 @@
+package listen
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.sock")
+	lis, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// leave the socket file behind, as a killed process would
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	regular := filepath.Join(dir, "regular")
+	if err = os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		addr    string
+		network string
+		wantErr bool
+	}{
+		{name: "port", addr: "0", network: "tcp"},
+		{name: "IPv4", addr: "127.0.0.1:0", network: "tcp"},
+		{name: "hostname", addr: "localhost:0", network: "tcp"},
+		{name: "unix socket", addr: "unix://" + filepath.Join(dir, "new.sock"), network: "unix"},
+		{name: "stale unix socket", addr: "unix://" + stale, network: "unix"},
+		{name: "not a socket", addr: "unix://" + regular, wantErr: true},
+		{name: "no socket path", addr: "unix://", wantErr: true},
+		{name: "no port", addr: "127.0.0.1", wantErr: true},
+		{name: "bad port", addr: "127.0.0.1:http-ish", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := Listen(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					lis.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			if network := lis.Addr().Network(); network != tt.network {
+				t.Errorf("got network %s, want %s", network, tt.network)
+			}
+			if IsUnix(lis) != (tt.network == "unix") {
+				t.Errorf("IsUnix: got %v", IsUnix(lis))
+			}
+		})
+	}
+	if _, err = os.Stat(regular); err != nil {
+		t.Errorf("a file that is not a socket was removed: %v", err)
+	}
+}
+
+func TestListenIPv4Only(t *testing.T) {
+	lis, err := Listen("0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if ip := lis.Addr().(*net.TCPAddr).IP; ip.To4() == nil {
+		t.Errorf("expected an IPv4 listener, got %s", ip)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	loopback, err := loopbackIPs()
+	if err != nil {
+		t.Skip(err)
+	}
+	addrs, err := expand([]string{"8443", "loopback:9090", "unix:///tmp/x.sock", "[::1]:8000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"8443"}
+	for _, ip := range loopback {
+		want = append(want, net.JoinHostPort(ip.String(), "9090"))
+	}
+	want = append(want, "unix:///tmp/x.sock", "[::1]:8000")
+	if len(addrs) != len(want) {
+		t.Fatalf("got %v, want %v", addrs, want)
+	}
+	for i := range want {
+		if addrs[i] != want[i] {
+			t.Errorf("got %v, want %v", addrs, want)
+			break
+		}
+	}
+}
+
+func TestListenAllClosesOnFailure(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "first.sock")
+	_, err := ListenAll([]string{"unix://" + sock, "unix://"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	// the first listener was closed, which removes its socket file
+	if _, err = os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the first listener to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package listen
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemd passes activated sockets as file descriptors starting at 3
+const listenFdsStart = 3
+
+type socketFile struct {
+	name string
+	file *os.File
+}
+
+var (
+	sockets     []*socketFile
+	socketsLock sync.Mutex
+	socketsOnce sync.Once
+	socketsErr  error
+)
+
+// activated adopts a socket passed in by systemd, so that each one is only used once.
+func activated(name string) (net.Listener, error) {
+	socketsOnce.Do(func() {
+		sockets, socketsErr = listenFds()
+	})
+	if socketsErr != nil {
+		return nil, socketsErr
+	}
+	socketsLock.Lock()
+	defer socketsLock.Unlock()
+
+	for i, sock := range sockets {
+		if name == "" || sock.name == name {
+			sockets = append(sockets[:i], sockets[i+1:]...)
+			lis, err := net.FileListener(sock.file)
+			// the listener has its own copy of the descriptor
+			sock.file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("cannot adopt systemd socket %s: %w", sock.name, err)
+			}
+			return lis, nil
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no unused systemd sockets")
+	}
+	return nil, fmt.Errorf("no systemd socket named %s", name)
+}
+
+func listenFds() ([]*socketFile, error) {
+	names, err := socketNames(os.Getpid(), os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+	if err != nil {
+		return nil, err
+	}
+	// don't pass the sockets on to any child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	res := make([]*socketFile, len(names))
+	for i, name := range names {
+		fd := uintptr(listenFdsStart + i)
+		res[i] = &socketFile{name: name, file: os.NewFile(fd, name)}
+	}
+	return res, nil
+}
+
+// socketNames returns the names of the sockets that systemd passed to the
+// process with the given pid, from its LISTEN_PID, LISTEN_FDS & LISTEN_FDNAMES.
+func socketNames(pid int, listenPID, listenFDs, fdNames string) ([]string, error) {
+	if target, err := strconv.Atoi(listenPID); err != nil || target != pid {
+		return nil, fmt.Errorf("no sockets were passed in by systemd")
+	}
+	count, err := strconv.Atoi(listenFDs)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("no sockets were passed in by systemd")
+	}
+	given := strings.Split(fdNames, ":")
+	names := make([]string, count)
+	for i := range names {
+		names[i] = "unknown" // systemd's default name
+		if i < len(given) && given[i] != "" {
+			names[i] = given[i]
+		}
+	}
+	return names, nil
+}
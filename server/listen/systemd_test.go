@@ -0,0 +1,99 @@
+package listen
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestSocketNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		listenPID string
+		listenFDs string
+		fdNames   string
+		want      []string
+	}{
+		{name: "named", listenPID: "42", listenFDs: "2", fdNames: "grpc:http", want: []string{"grpc", "http"}},
+		{name: "unnamed", listenPID: "42", listenFDs: "2", want: []string{"unknown", "unknown"}},
+		{name: "some named", listenPID: "42", listenFDs: "3", fdNames: "grpc::admin", want: []string{"grpc", "unknown", "admin"}},
+		{name: "fewer names", listenPID: "42", listenFDs: "2", fdNames: "grpc", want: []string{"grpc", "unknown"}},
+		{name: "extra names", listenPID: "42", listenFDs: "1", fdNames: "grpc:http", want: []string{"grpc"}},
+		{name: "duplicate names", listenPID: "42", listenFDs: "2", fdNames: "http:http", want: []string{"http", "http"}},
+		{name: "another process", listenPID: "43", listenFDs: "1", fdNames: "grpc"},
+		{name: "no pid", listenFDs: "1", fdNames: "grpc"},
+		{name: "bad pid", listenPID: "wibble", listenFDs: "1"},
+		{name: "no fds", listenPID: "42"},
+		{name: "zero fds", listenPID: "42", listenFDs: "0"},
+		{name: "negative fds", listenPID: "42", listenFDs: "-1"},
+		{name: "bad fds", listenPID: "42", listenFDs: "two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := socketNames(42, tt.listenPID, tt.listenFDs, tt.fdNames)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivated(t *testing.T) {
+	// stand in for the sockets that systemd would have passed in
+	socketsOnce.Do(func() {})
+	var files []*socketFile
+	for _, name := range []string{"grpc", "http", "http"} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := lis.(*net.TCPListener).File()
+		lis.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &socketFile{name: name, file: file})
+	}
+	socketsLock.Lock()
+	sockets = files
+	socketsLock.Unlock()
+
+	// in order, since each step adopts from the sockets that the earlier ones left
+	tests := []struct {
+		name    string
+		socket  string
+		wantErr bool
+	}{
+		{name: "named", socket: "http"},
+		{name: "unknown name", socket: "admin", wantErr: true},
+		{name: "next unused", socket: ""},
+		{name: "already adopted", socket: "grpc", wantErr: true},
+		{name: "same name again", socket: "http"},
+		{name: "all adopted", socket: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := Listen(systemdScheme + tt.socket)
+			if tt.wantErr {
+				if err == nil {
+					lis.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			lis.Close()
+		})
+	}
+}
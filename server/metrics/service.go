@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tomcz/example-grpc/server"
+	"github.com/tomcz/example-grpc/server/listen"
+)
+
+type service struct {
+	*server.Readiness
+	server *http.Server
+	addrs  []string
+}
+
+// NewService creates a plain HTTP service that publishes expvar metrics on
+// /debug/vars. It is unauthenticated, so bind it to private or loopback addresses.
+func NewService(addrs []string) server.Service {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return &service{
+		Readiness: server.NewReadiness(),
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		addrs: addrs,
+	}
+}
+
+func (s *service) ListenAndServe() error {
+	listeners, err := listen.ListenAll(s.addrs)
+	if err != nil {
+		return err
+	}
+	addrs := listen.Addrs(listeners)
+	for _, addr := range addrs {
+		log.WithField("addr", addr).Info("starting metrics server")
+	}
+	s.SetReady(addrs)
+	err = listen.Serve(listeners, s.server.Serve)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *service) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.server.Close()
+	}
+	return err
+}
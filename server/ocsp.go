@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+// responses without a nextUpdate are still worth keeping for a little while
+const ocspMinCacheTime = time.Minute
+
+// don't wait on an unreachable responder for every request
+const ocspFailureBackoff = 30 * time.Second
+
+type ocspFailure struct {
+	err   error
+	until time.Time
+}
+
+type ocspChecker struct {
+	issuer       *x509.Certificate
+	responderURL string
+	hardFail     bool
+	client       *http.Client
+
+	cacheLock sync.Mutex
+	cache     map[string]*ocsp.Response
+	failures  map[string]*ocspFailure
+}
+
+// NewOCSPChecker creates a RevocationChecker that asks an OCSP responder about
+// certificates issued by the CA certificate, or by an intermediate CA in the
+// client's verified certificate chain. The responder is either the given
+// URL or, when that is empty, the certificate's own OCSP server. Responses are
+// cached until their nextUpdate time. When the responder cannot be reached a
+// hard-fail checker rejects the certificate, while a soft-fail one allows it,
+// and the failure is remembered for a short while before trying again.
+func NewOCSPChecker(caFile, responderURL string, hardFail bool, client *http.Client) (RevocationChecker, error) {
+	issuer, err := readCertificate(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read OCSP issuer: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &ocspChecker{
+		issuer:       issuer,
+		responderURL: responderURL,
+		hardFail:     hardFail,
+		client:       client,
+		cache:        make(map[string]*ocsp.Response),
+		failures:     make(map[string]*ocspFailure),
+	}, nil
+}
+
+func (o *ocspChecker) Check(cert, issuer *x509.Certificate) error {
+	if issuer == nil {
+		issuer = o.issuer
+	}
+	res, err := o.response(cert, issuer)
+	if err != nil {
+		if o.hardFail {
+			return fmt.Errorf("%w: OCSP check failed: %w", ErrRevocationUnknown, err)
+		}
+		log.WithError(err).WithField("serial", cert.SerialNumber).Warn("OCSP check failed, allowing certificate")
+		return nil
+	}
+	switch res.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%w - serial: %s, revoked at: %s", ErrCertRevoked, cert.SerialNumber, res.RevokedAt)
+	default:
+		if o.hardFail {
+			return fmt.Errorf("%w: OCSP status unknown - serial: %s", ErrRevocationUnknown, cert.SerialNumber)
+		}
+		log.WithField("serial", cert.SerialNumber).Warn("OCSP status unknown, allowing certificate")
+		return nil
+	}
+}
+
+func (o *ocspChecker) response(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	key := string(cert.RawIssuer) + cert.SerialNumber.String()
+	now := time.Now()
+
+	o.cacheLock.Lock()
+	cached, ok := o.cache[key]
+	failed := o.failures[key]
+	o.cacheLock.Unlock()
+	if ok && now.Before(ocspExpiry(cached)) {
+		return cached, nil
+	}
+	if failed != nil && now.Before(failed.until) {
+		return nil, failed.err
+	}
+
+	res, err := o.fetch(cert, issuer)
+
+	o.cacheLock.Lock()
+	defer o.cacheLock.Unlock()
+	for k, r := range o.cache {
+		if now.After(ocspExpiry(r)) {
+			delete(o.cache, k)
+		}
+	}
+	for k, f := range o.failures {
+		if now.After(f.until) {
+			delete(o.failures, k)
+		}
+	}
+	if err != nil {
+		o.failures[key] = &ocspFailure{err: err, until: now.Add(ocspFailureBackoff)}
+		return nil, err
+	}
+	delete(o.failures, key)
+	o.cache[key] = res
+	return res, nil
+}
+
+func (o *ocspChecker) fetch(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	url := o.responderURL
+	if url == "" {
+		if len(cert.OCSPServer) == 0 {
+			return nil, fmt.Errorf("no OCSP responder for serial %s", cert.SerialNumber)
+		}
+		url = cert.OCSPServer[0]
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpRes, err := o.client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected OCSP responder status: %s", httpRes.Status)
+	}
+	buf, err := io.ReadAll(io.LimitReader(httpRes.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(buf, cert, issuer)
+}
+
+func ocspExpiry(res *ocsp.Response) time.Time {
+	if res.NextUpdate.IsZero() {
+		return res.ThisUpdate.Add(ocspMinCacheTime)
+	}
+	return res.NextUpdate
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPCachesFailures(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ca, cert := testCertPair(t)
+	for _, hardFail := range []bool{false, true} {
+		requests.Store(0)
+		checker := &ocspChecker{
+			issuer:       ca,
+			responderURL: srv.URL,
+			hardFail:     hardFail,
+			client:       srv.Client(),
+			cache:        make(map[string]*ocsp.Response),
+			failures:     make(map[string]*ocspFailure),
+		}
+		for range 3 {
+			err := checker.Check(cert, nil)
+			switch {
+			case !hardFail && err != nil:
+				t.Fatalf("soft-fail rejected certificate: %v", err)
+			case hardFail && !errors.Is(err, ErrRevocationUnknown):
+				t.Fatalf("expected unknown revocation status, got %v", err)
+			case errors.Is(err, ErrCertRevoked):
+				t.Fatalf("unreachable responder reported as revoked: %v", err)
+			}
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("hard fail %v: expected one responder request, got %d", hardFail, n)
+		}
+	}
+}
+
+func testCertPair(t *testing.T) (*x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	ca, caKey := newTestCA(t, "test ca", nil, nil)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "alice.example.com"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, cert
+}
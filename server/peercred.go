@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ErrNoPeerMatch authentication failure
+var ErrNoPeerMatch = errors.New("no peer credentials match")
+
+// PeerCreds are the credentials of the local process
+// at the other end of a unix domain socket.
+type PeerCreds struct {
+	PID int
+	UID int
+	GID int
+}
+
+// GetPeerCreds returns the peer credentials of a unix domain socket connection.
+// It returns nil for other connections, and on platforms without SO_PEERCRED.
+func GetPeerCreds(conn net.Conn) (*PeerCreds, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil
+	}
+	return getPeerCreds(uc)
+}
+
+// WithPeerCreds stores the peer credentials of a connection in its context.
+func WithPeerCreds(ctx context.Context, creds *PeerCreds) context.Context {
+	return context.WithValue(ctx, peerCredsKey, creds)
+}
+
+// CurrentPeerCreds retrieves the connection's peer credentials, or returns nil.
+func CurrentPeerCreds(ctx context.Context) *PeerCreds {
+	if creds, ok := ctx.Value(peerCredsKey).(*PeerCreds); ok {
+		return creds
+	}
+	return nil
+}
+
+// PeerAllowList describes the local users that may
+// authenticate with their unix socket peer credentials.
+type PeerAllowList interface {
+	Allow(creds *PeerCreds) (*Principal, error)
+	Enabled() bool
+}
+
+type peerAllowList map[int]string
+
+// NewPeerAllowList creates an allow list from a comma-separated set
+// of local usernames or numeric user IDs, which must exist.
+func NewPeerAllowList(usersCSV string) (PeerAllowList, error) {
+	users := make(peerAllowList)
+	for _, name := range strings.Split(usersCSV, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var (
+			u   *user.User
+			err error
+		)
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			u, err = user.LookupId(name)
+		} else {
+			u, err = user.Lookup(name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot find peer user: %w", err)
+		}
+		uid, err := strconv.Atoi(u.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported uid %q for %s", u.Uid, u.Username)
+		}
+		users[uid] = u.Username
+	}
+	return users, nil
+}
+
+func (p peerAllowList) Allow(creds *PeerCreds) (*Principal, error) {
+	name, ok := p[creds.UID]
+	if !ok {
+		return nil, fmt.Errorf("%w - uid: %d", ErrNoPeerMatch, creds.UID)
+	}
+	return &Principal{
+		Name:   name,
+		Method: AuthMethodPeerCred,
+		Attributes: map[string]string{
+			"pid": strconv.Itoa(creds.PID),
+			"uid": strconv.Itoa(creds.UID),
+			"gid": strconv.Itoa(creds.GID),
+		},
+	}, nil
+}
+
+func (p peerAllowList) Enabled() bool {
+	return len(p) != 0
+}
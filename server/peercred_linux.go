@@ -0,0 +1,34 @@
+//go:build linux
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func getPeerCreds(conn *net.UnixConn) (*PeerCreds, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ucred   *syscall.Ucred
+		credErr error
+	)
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read peer credentials: %w", err)
+	}
+	return &PeerCreds{
+		PID: int(ucred.Pid),
+		UID: int(ucred.Uid),
+		GID: int(ucred.Gid),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Fingerprint kinds understood by NewPinnedAllowList.
+const (
+	PinCert = "cert"
+	PinSPKI = "spki"
+)
+
+type pinnedAllowList struct {
+	certs map[string]string
+	spkis map[string]string
+}
+
+// NewPinnedAllowList creates an allow list of exact client certificates from a file
+// with one "<kind> <sha256 fingerprint> <username>" entry per line. The kind is
+// either "cert", to pin the whole leaf certificate, or "spki", to pin its public
+// key so that the certificate can be re-issued for the same key. Fingerprints are
+// hex-encoded and may contain colons, and lines starting with # are ignored.
+func NewPinnedAllowList(pinsFile string) (AllowList, error) {
+	buf, err := os.ReadFile(pinsFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pins file: %w", err)
+	}
+	p := &pinnedAllowList{
+		certs: make(map[string]string),
+		spkis: make(map[string]string),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("pins file line %d: expected <kind> <fingerprint> <username>", lineNo)
+		}
+		fingerprint := strings.ToLower(strings.ReplaceAll(fields[1], ":", ""))
+		if raw, err := hex.DecodeString(fingerprint); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("pins file line %d: malformed SHA-256 fingerprint", lineNo)
+		}
+		switch fields[0] {
+		case PinCert:
+			p.certs[fingerprint] = fields[2]
+		case PinSPKI:
+			p.spkis[fingerprint] = fields[2]
+		default:
+			return nil, fmt.Errorf("pins file line %d: unknown kind %q", lineNo, fields[0])
+		}
+	}
+	return p, scanner.Err()
+}
+
+func (p *pinnedAllowList) Enabled() bool {
+	return len(p.certs) > 0 || len(p.spkis) > 0
+}
+
+func (p *pinnedAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
+	fingerprint := CertFingerprint(cert)
+	if username, ok := p.certs[fingerprint]; ok {
+		return NewCertPrincipal(username, cert), nil
+	}
+	spki := SPKIFingerprint(cert)
+	if username, ok := p.spkis[spki]; ok {
+		principal := NewCertPrincipal(username, cert)
+		principal.Attributes["spki_fingerprint"] = spki
+		return principal, nil
+	}
+	return nil, fmt.Errorf("%w - fingerprint: %s", ErrNoCertMatch, fingerprint)
+}
+
+// SPKIFingerprint returns the hex-encoded SHA-256 of the certificate's SubjectPublicKeyInfo.
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+type anyAllowList []AllowList
+
+// NewAnyAllowList combines allow lists so that a certificate is allowed
+// by the first enabled allow list that accepts it.
+func NewAnyAllowList(lists ...AllowList) AllowList {
+	var enabled anyAllowList
+	for _, list := range lists {
+		if list.Enabled() {
+			enabled = append(enabled, list)
+		}
+	}
+	return enabled
+}
+
+func (a anyAllowList) Enabled() bool {
+	return len(a) > 0
+}
+
+func (a anyAllowList) Allow(cert *x509.Certificate) (*Principal, error) {
+	return a.AllowChain([]*x509.Certificate{cert})
+}
+
+// AllowChain passes the whole chain on, so that combined
+// allow lists can still check more than the leaf certificate.
+func (a anyAllowList) AllowChain(chain []*x509.Certificate) (*Principal, error) {
+	err := fmt.Errorf("%w - CN: %s", ErrNoCertMatch, chain[0].Subject.CommonName)
+	for _, list := range a {
+		principal, listErr := AllowChain(list, chain)
+		if listErr == nil {
+			return principal, nil
+		}
+		err = listErr
+	}
+	return nil, err
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPinnedAllowList(t *testing.T) {
+	ca, _ := newTestCA(t, "pinned ca", nil, nil)
+	other, _ := newTestCA(t, "other ca", nil, nil)
+	pins := "# kind fingerprint username\n" +
+		"cert " + colons(CertFingerprint(ca)) + " deployer\n" +
+		"spki " + SPKIFingerprint(other) + " backup-agent\n"
+	filename := filepath.Join(t.TempDir(), "pins.txt")
+	if err := os.WriteFile(filename, []byte(pins), 0600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := NewPinnedAllowList(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := list.Allow(ca); err != nil || p.Name != "deployer" {
+		t.Fatalf("expected deployer, got %v, %v", p, err)
+	}
+	p, err := list.Allow(other)
+	if err != nil || p.Name != "backup-agent" || p.Attributes["spki_fingerprint"] != SPKIFingerprint(other) {
+		t.Fatalf("expected backup-agent, got %v, %v", p, err)
+	}
+	unknown, _ := newTestCA(t, "unknown ca", nil, nil)
+	if _, err = list.Allow(unknown); !errors.Is(err, ErrNoCertMatch) {
+		t.Fatalf("expected ErrNoCertMatch, got %v", err)
+	}
+}
+
+func TestPinnedAllowListBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		pins string
+	}{
+		{name: "missing username", pins: "cert 00\n"},
+		{name: "short fingerprint", pins: "cert abcd alice\n"},
+		{name: "unknown kind", pins: "key " + SPKIFingerprint(&x509.Certificate{}) + " alice\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "pins.txt")
+			if err := os.WriteFile(filename, []byte(tc.pins), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewPinnedAllowList(filename); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// chainRecorder is an allow list that needs to see the whole chain
+type chainRecorder struct {
+	chain []*x509.Certificate
+}
+
+func (c *chainRecorder) Allow(cert *x509.Certificate) (*Principal, error) {
+	return c.AllowChain([]*x509.Certificate{cert})
+}
+
+func (c *chainRecorder) AllowChain(chain []*x509.Certificate) (*Principal, error) {
+	c.chain = chain
+	return NewCertPrincipal(chain[0].Subject.CommonName, chain[0]), nil
+}
+
+func (c *chainRecorder) Enabled() bool {
+	return true
+}
+
+func TestAllowListWrappersPassTheChain(t *testing.T) {
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "issuing ca"}}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	chain := []*x509.Certificate{leaf, issuer}
+
+	recorder := &chainRecorder{}
+	pins := &pinnedAllowList{certs: map[string]string{}, spkis: map[string]string{}}
+	list := NewExpiryWarningAllowList(NewAnyAllowList(pins, recorder), 24*time.Hour)
+	if _, err := AllowChain(list, chain); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.chain) != 2 || recorder.chain[1] != issuer {
+		t.Fatalf("expected the whole chain, got %d certificates", len(recorder.chain))
+	}
+
+	// revocation checks are not necessarily the outermost allow list
+	checker := &issuerRecorder{}
+	list = NewExpiryWarningAllowList(NewAnyAllowList(pins, NewRevocationAllowList(NewDomainAllowList("alice"), checker)), 24*time.Hour)
+	if _, err := AllowChain(list, chain); err != nil {
+		t.Fatal(err)
+	}
+	if checker.issuer != issuer {
+		t.Fatal("expected the revocation checker to see the issuer from the chain")
+	}
+}
+
+type issuerRecorder struct {
+	issuer *x509.Certificate
+}
+
+func (i *issuerRecorder) Check(_, issuer *x509.Certificate) error {
+	i.issuer = issuer
+	return nil
+}
+
+func colons(fingerprint string) string {
+	var buf []byte
+	for i := 0; i < len(fingerprint); i += 2 {
+		if i > 0 {
+			buf = append(buf, ':')
+		}
+		buf = append(buf, fingerprint[i:i+2]...)
+	}
+	return string(buf)
+}
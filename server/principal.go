@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// AuthMethod describes how a caller was authenticated.
+type AuthMethod string
+
+const (
+	// AuthMethodToken callers presented a bearer token.
+	AuthMethodToken AuthMethod = "token"
+	// AuthMethodMTLS callers presented a client TLS certificate.
+	AuthMethodMTLS AuthMethod = "mtls"
+	// AuthMethodPeerCred callers are local processes on a unix domain socket.
+	AuthMethodPeerCred AuthMethod = "peercred"
+)
+
+// Principal describes an authenticated caller.
+type Principal struct {
+	Name       string
+	Method     AuthMethod
+	Roles      []string
+	Attributes map[string]string
+	// CertFingerprint is the hex-encoded SHA-256 of an mTLS client certificate.
+	CertFingerprint string
+	// TokenID identifies the bearer token (e.g. a JWT "jti" claim), if known.
+	TokenID string
+	// Expiry of the presented credential, or zero if it does not expire.
+	Expiry time.Time
+}
+
+// NewCertPrincipal creates an mTLS principal for the given client certificate.
+func NewCertPrincipal(name string, cert *x509.Certificate) *Principal {
+	return &Principal{
+		Name:            name,
+		Method:          AuthMethodMTLS,
+		CertFingerprint: CertFingerprint(cert),
+		Expiry:          cert.NotAfter,
+		Attributes: map[string]string{
+			"subject": cert.Subject.String(),
+			"issuer":  cert.Issuer.String(),
+			"serial":  cert.SerialNumber.String(),
+		},
+	}
+}
+
+// CertFingerprint returns the hex-encoded SHA-256 of the certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// HasRole returns true if the principal has been granted the role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	peerCredsKey
+)
+
+// WithPrincipal store the principal under a well-known context key
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// CurrentPrincipal retrieves the existing principal, or returns nil
+func CurrentPrincipal(ctx context.Context) *Principal {
+	if principal, ok := ctx.Value(principalKey).(*Principal); ok {
+		return principal
+	}
+	return nil
+}
+
+// WithUserName store a principal that only has a username
+func WithUserName(ctx context.Context, username string) context.Context {
+	return WithPrincipal(ctx, &Principal{Name: username})
+}
+
+// UserName retrieves the existing username, or returns an empty string
+func UserName(ctx context.Context) string {
+	if principal := CurrentPrincipal(ctx); principal != nil {
+		return principal.Name
+	}
+	return ""
+}
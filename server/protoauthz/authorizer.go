@@ -0,0 +1,166 @@
+package protoauthz
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/server"
+)
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	roles   []string
+}
+
+type authorizer struct {
+	methods map[string][]string
+	routes  []route
+}
+
+// NewAuthorizer enforces the example.auth.required_roles options declared on
+// the methods of the given services, which are read from their registered
+// proto descriptors. Each rule applies to the full gRPC method name, as well
+// as to any HTTP routes bound to the method via google.api.http.
+func NewAuthorizer(services ...*grpc.ServiceDesc) (server.Authorizer, error) {
+	a := &authorizer{methods: make(map[string][]string)}
+	for _, service := range services {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service.ServiceName))
+		if err != nil {
+			return nil, fmt.Errorf("cannot find service %s: %w", service.ServiceName, err)
+		}
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", service.ServiceName)
+		}
+		methods := sd.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			if err = a.addMethod(sd, methods.Get(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a *authorizer) addMethod(sd protoreflect.ServiceDescriptor, md protoreflect.MethodDescriptor) error {
+	opts := md.Options()
+	roles, _ := proto.GetExtension(opts, api.E_RequiredRoles).([]string)
+	if len(roles) == 0 {
+		return nil
+	}
+	a.methods[fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())] = roles
+	rule, ok := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+	for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		method, tmpl := httpBinding(binding)
+		if tmpl == "" {
+			continue
+		}
+		pattern, err := templateRegexp(tmpl)
+		if err != nil {
+			return fmt.Errorf("bad HTTP template %q on %s: %w", tmpl, md.FullName(), err)
+		}
+		a.routes = append(a.routes, route{method: method, pattern: pattern, roles: roles})
+	}
+	return nil
+}
+
+func (a *authorizer) Enabled() bool {
+	return len(a.methods) > 0
+}
+
+func (a *authorizer) Authorize(principal *server.Principal, resource string) error {
+	roles := a.requiredRoles(resource)
+	if len(roles) == 0 {
+		return nil
+	}
+	if principal != nil {
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w - resource %q requires one of roles %v", server.ErrAccessDenied, resource, roles)
+}
+
+func (a *authorizer) requiredRoles(resource string) []string {
+	if roles, ok := a.methods[resource]; ok {
+		return roles
+	}
+	method, path, ok := strings.Cut(resource, " ")
+	if !ok {
+		return nil
+	}
+	for _, r := range a.routes {
+		if r.method == method && r.pattern.MatchString(path) {
+			return r.roles
+		}
+	}
+	return nil
+}
+
+func httpBinding(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return "", ""
+	}
+}
+
+// templateRegexp converts a google.api.http path template, such as
+// "/v1/{name=shelves/*}/books/**:publish", into an anchored regexp.
+func templateRegexp(tmpl string) (*regexp.Regexp, error) {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for len(tmpl) > 0 {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			buf.WriteString(segmentsRegexp(tmpl))
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated variable")
+		}
+		buf.WriteString(segmentsRegexp(tmpl[:start]))
+		variable := tmpl[start+1 : start+end]
+		if _, pattern, ok := strings.Cut(variable, "="); ok {
+			buf.WriteString(segmentsRegexp(pattern))
+		} else {
+			buf.WriteString("[^/]+")
+		}
+		tmpl = tmpl[start+end+1:]
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+func segmentsRegexp(segments string) string {
+	quoted := regexp.QuoteMeta(segments)
+	quoted = strings.ReplaceAll(quoted, `\*\*`, `.+`)
+	return strings.ReplaceAll(quoted, `\*`, `[^/]+`)
+}
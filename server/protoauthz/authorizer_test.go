@@ -0,0 +1,166 @@
+package protoauthz
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/tomcz/example-grpc/api"
+	"github.com/tomcz/example-grpc/server"
+)
+
+func TestAuthorizer(t *testing.T) {
+	authz, err := NewAuthorizer(&api.Example_ServiceDesc, &api.Issuer_ServiceDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authz.Enabled() {
+		t.Fatal("expected Echo's required roles to enable the authorizer")
+	}
+	echoer := &server.Principal{Name: "alice", Roles: []string{"developer", "echoer"}}
+	other := &server.Principal{Name: "bob", Roles: []string{"developer"}}
+	tests := []struct {
+		name      string
+		principal *server.Principal
+		resource  string
+		allowed   bool
+	}{
+		{name: "grpc method with role", principal: echoer, resource: "/example.service.Example/Echo", allowed: true},
+		{name: "grpc method without role", principal: other, resource: "/example.service.Example/Echo"},
+		{name: "grpc method without principal", resource: "/example.service.Example/Echo"},
+		{name: "http route with role", principal: echoer, resource: "POST /v1/example/echo", allowed: true},
+		{name: "http route without role", principal: other, resource: "POST /v1/example/echo"},
+		{name: "http route, other method", principal: other, resource: "GET /v1/example/echo", allowed: true},
+		{name: "http route, other path", principal: other, resource: "POST /v1/example/echo/more", allowed: true},
+		{name: "method without options", principal: other, resource: "/example.issuer.Issuer/IssueCertificate", allowed: true},
+		{name: "unknown method", principal: other, resource: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authz.Authorize(tt.principal, tt.resource)
+			if tt.allowed {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, server.ErrAccessDenied) {
+				t.Fatalf("expected ErrAccessDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizerWithoutOptions(t *testing.T) {
+	authz, err := NewAuthorizer(&api.Issuer_ServiceDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authz.Enabled() {
+		t.Fatal("expected no required roles on the issuer")
+	}
+}
+
+func TestAuthorizerUnknownService(t *testing.T) {
+	_, err := NewAuthorizer(&grpc.ServiceDesc{ServiceName: "example.service.Missing"})
+	if err == nil {
+		t.Fatal("expected an error for an unregistered service")
+	}
+}
+
+func TestTemplateRegexp(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		matches []string
+		rejects []string
+	}{
+		{
+			tmpl:    "/v1/example/echo",
+			matches: []string{"/v1/example/echo"},
+			rejects: []string{"/v1/example/echo/", "/v1/example/echoes", "/v1/example", "/v1/example.echo", "/x/v1/example/echo"},
+		},
+		{
+			tmpl:    "/v1/{name}",
+			matches: []string{"/v1/shelf"},
+			rejects: []string{"/v1/", "/v1/shelves/1"},
+		},
+		{
+			tmpl:    "/v1/{name=shelves/*}",
+			matches: []string{"/v1/shelves/1"},
+			rejects: []string{"/v1/shelves/", "/v1/shelves/1/books/2", "/v1/drawers/1"},
+		},
+		{
+			tmpl:    "/v1/{name=shelves/*/books/*}",
+			matches: []string{"/v1/shelves/1/books/2"},
+			rejects: []string{"/v1/shelves/1/books", "/v1/shelves/1/books/2/pages/3"},
+		},
+		{
+			tmpl:    "/v1/{name=**}",
+			matches: []string{"/v1/a", "/v1/a/b/c"},
+			rejects: []string{"/v1/", "/v2/a"},
+		},
+		{
+			tmpl:    "/v1/files/**",
+			matches: []string{"/v1/files/a", "/v1/files/a/b"},
+			rejects: []string{"/v1/files/"},
+		},
+		{
+			tmpl:    "/v1/{name=shelves/*}:publish",
+			matches: []string{"/v1/shelves/1:publish"},
+			rejects: []string{"/v1/shelves/1", "/v1/shelves/1:unpublish", "/v1/shelves/1/books:publish"},
+		},
+		{
+			tmpl:    "/v1/{name=**}:cancel",
+			matches: []string{"/v1/ops/1:cancel", "/v1/ops/1/sub/2:cancel"},
+			rejects: []string{"/v1/ops/1", "/v1/:cancel"},
+		},
+		{
+			tmpl:    "/v1/{parent=shelves/*}/books/{book}",
+			matches: []string{"/v1/shelves/1/books/2"},
+			rejects: []string{"/v1/shelves/1/books/", "/v1/shelves/1/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			re, err := templateRegexp(tt.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range tt.matches {
+				if !re.MatchString(path) {
+					t.Errorf("%s (%s) should match %s", tt.tmpl, re, path)
+				}
+			}
+			for _, path := range tt.rejects {
+				if re.MatchString(path) {
+					t.Errorf("%s (%s) should not match %s", tt.tmpl, re, path)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateRegexpErrors(t *testing.T) {
+	if _, err := templateRegexp("/v1/{name"); err == nil {
+		t.Fatal("expected an error for an unterminated variable")
+	}
+}
+
+func TestSegmentsRegexp(t *testing.T) {
+	tests := []struct {
+		segments string
+		want     string
+	}{
+		{segments: "/v1/example/echo", want: `/v1/example/echo`},
+		{segments: "shelves/*", want: `shelves/[^/]+`},
+		{segments: "**", want: `.+`},
+		{segments: "/books/**:publish", want: `/books/.+:publish`},
+		{segments: "/v1.2/a+b", want: `/v1\.2/a\+b`},
+	}
+	for _, tt := range tests {
+		if got := segmentsRegexp(tt.segments); got != tt.want {
+			t.Errorf("segmentsRegexp(%q): got %s, want %s", tt.segments, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,67 @@
 package server
 
+import (
+	"context"
+	"net"
+	"sync"
+)
+
 // Service represents a startable & stoppable service.
 type Service interface {
+	// ListenAndServe blocks until the service stops.
 	ListenAndServe() error
-	GracefulStop()
+	// Ready is closed once the service is listening on all of its addresses.
+	// It is never closed when the service fails to start listening.
+	Ready() <-chan struct{}
+	// Addr returns the first address that the service is listening on,
+	// or nil when it is not ready.
+	Addr() net.Addr
+	// Addrs returns all the addresses that the service is listening on,
+	// or nothing when it is not ready.
+	Addrs() []net.Addr
+	// Shutdown stops the service, and waits for in-flight requests to finish
+	// until the context is done, when it closes them & returns the context error.
+	Shutdown(ctx context.Context) error
+}
+
+// Readiness keeps track of when & where a service is listening,
+// so that services only need to implement the rest of Service.
+type Readiness struct {
+	ready chan struct{}
+	once  sync.Once
+	addrs []net.Addr
+}
+
+// NewReadiness creates a service that is not yet ready.
+func NewReadiness() *Readiness {
+	return &Readiness{ready: make(chan struct{})}
+}
+
+// SetReady records the addresses that a service is listening on. Only the first call counts.
+func (r *Readiness) SetReady(addrs []net.Addr) {
+	r.once.Do(func() {
+		r.addrs = addrs
+		close(r.ready)
+	})
+}
+
+func (r *Readiness) Ready() <-chan struct{} {
+	return r.ready
+}
+
+func (r *Readiness) Addr() net.Addr {
+	if addrs := r.Addrs(); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return nil
+}
+
+func (r *Readiness) Addrs() []net.Addr {
+	select {
+	case <-r.ready:
+		// addrs do not change once ready
+		return r.addrs
+	default:
+		return nil
+	}
 }
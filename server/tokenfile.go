@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tomcz/example-grpc/filewatch"
+)
+
+// TokenEntry describes a bearer token in a token file.
+type TokenEntry struct {
+	User string `yaml:"user"`
+	// ID is the non-secret prefix of tokens created by NewToken,
+	// in which case TokenHash holds the HashToken output for its secret.
+	// Without an ID, TokenHash is "sha256:" followed by the hex-encoded
+	// SHA-256 of the whole token.
+	ID        string    `yaml:"id,omitempty"`
+	TokenHash string    `yaml:"token_hash"`
+	Expires   time.Time `yaml:"expires,omitempty"`
+	Roles     []string  `yaml:"roles,omitempty"`
+}
+
+type tokenStore struct {
+	byID   map[string]TokenEntry
+	byHash map[string]TokenEntry
+}
+
+type fileTokenAuth struct {
+	filename string
+	store    atomic.Pointer[tokenStore]
+}
+
+// NewFileTokenAuth represents bearer token authentication using a YAML or JSON
+// file of token hashes. The file is reloaded whenever it changes, until the context
+// is cancelled, and the previous tokens stay in use when a reload is invalid.
+func NewFileTokenAuth(ctx context.Context, filename string) (TokenAuth, error) {
+	f := &fileTokenAuth{filename: filename}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	if err := filewatch.Files(ctx, f.onChange, filename); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileTokenAuth) Scheme() string {
+	return "bearer"
+}
+
+func (f *fileTokenAuth) Authenticate(token string) (*Principal, error) {
+	entry, err := f.store.Load().lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		return nil, fmt.Errorf("%w: token for %s expired at %s", ErrInvalidToken, entry.User, entry.Expires)
+	}
+	return &Principal{
+		Name:    entry.User,
+		Method:  AuthMethodToken,
+		Roles:   entry.Roles,
+		TokenID: entry.ID,
+		Expiry:  entry.Expires,
+	}, nil
+}
+
+func (s *tokenStore) lookup(token string) (TokenEntry, error) {
+	if id, secret, ok := SplitToken(token); ok {
+		if entry, found := s.byID[id]; found {
+			ok, err := VerifyTokenHash(entry.TokenHash, secret)
+			if err != nil {
+				return entry, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+			}
+			if ok {
+				return entry, nil
+			}
+			return entry, ErrInvalidToken
+		}
+	}
+	// unsalted hashes are only looked up by their digest,
+	// so timing reveals nothing useful about the token
+	if entry, found := s.byHash[hashToken(token)]; found {
+		return entry, nil
+	}
+	return TokenEntry{}, ErrInvalidToken
+}
+
+func (f *fileTokenAuth) onChange() {
+	ll := log.WithField("file", f.filename)
+	if err := f.reload(); err != nil {
+		ll.WithError(err).Error("token file reload rejected, keeping previous tokens")
+		return
+	}
+	ll.Info("token file reloaded")
+}
+
+func (f *fileTokenAuth) reload() error {
+	buf, err := os.ReadFile(f.filename)
+	if err != nil {
+		return fmt.Errorf("cannot read token file: %w", err)
+	}
+	var file struct {
+		Tokens []TokenEntry `yaml:"tokens"`
+	}
+	if err = yaml.Unmarshal(buf, &file); err != nil {
+		return fmt.Errorf("cannot parse token file: %w", err)
+	}
+	store := &tokenStore{
+		byID:   make(map[string]TokenEntry),
+		byHash: make(map[string]TokenEntry),
+	}
+	for i, entry := range file.Tokens {
+		if entry.User == "" {
+			return fmt.Errorf("token %d: missing user", i)
+		}
+		if entry.ID != "" {
+			// a later entry must not silently replace an earlier one
+			if _, found := store.byID[entry.ID]; found {
+				return fmt.Errorf("token %d: duplicate id %s", i, entry.ID)
+			}
+			if err = CheckTokenHash(entry.TokenHash); err != nil {
+				return fmt.Errorf("token %d: %w", i, err)
+			}
+			store.byID[entry.ID] = entry
+			continue
+		}
+		hash, ok := strings.CutPrefix(entry.TokenHash, "sha256:")
+		if !ok {
+			return fmt.Errorf("token %d: unsupported token hash", i)
+		}
+		if _, err = hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return fmt.Errorf("token %d: malformed token hash", i)
+		}
+		hash = strings.ToLower(hash)
+		if _, found := store.byHash[hash]; found {
+			return fmt.Errorf("token %d: duplicate token hash", i)
+		}
+		store.byHash[hash] = entry
+	}
+	f.store.Store(store)
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
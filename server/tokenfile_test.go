@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTokenAuthRejectsBadFiles(t *testing.T) {
+	hash, err := HashToken(HashSHA256, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := hashToken("wibble")
+	tests := []struct {
+		name   string
+		tokens string
+		err    string
+	}{
+		{
+			name:   "missing user",
+			tokens: "  - id: abc\n    token_hash: " + hash + "\n",
+			err:    "missing user",
+		},
+		{
+			name:   "duplicate id",
+			tokens: "  - user: alice\n    id: abc\n    token_hash: " + hash + "\n  - user: mallory\n    id: abc\n    token_hash: " + hash + "\n",
+			err:    "token 1: duplicate id abc",
+		},
+		{
+			name:   "duplicate hash",
+			tokens: "  - user: alice\n    token_hash: sha256:" + plain + "\n  - user: mallory\n    token_hash: sha256:" + strings.ToUpper(plain) + "\n",
+			err:    "token 1: duplicate token hash",
+		},
+		{
+			name:   "expensive argon2id",
+			tokens: "  - user: alice\n    id: abc\n    token_hash: $argon2id$v=19$m=4194304,t=3,p=4$c2FsdA$a2V5\n",
+			err:    "unsupported argon2id memory",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "tokens.yaml")
+			if err := os.WriteFile(filename, []byte("tokens:\n"+tc.tokens), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewFileTokenAuth(context.Background(), filename)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestFileTokenAuth(t *testing.T) {
+	id, token, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, _ := SplitToken(token)
+	hash, err := HashToken(HashSHA256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := "tokens:\n" +
+		"  - user: alice\n    id: " + id + "\n    token_hash: " + hash + "\n    roles: [echoer]\n" +
+		"  - user: bob\n    token_hash: sha256:" + hashToken("wibble") + "\n"
+	filename := filepath.Join(t.TempDir(), "tokens.yaml")
+	if err = os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	auth, err := NewFileTokenAuth(ctx, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := auth.Authenticate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "alice" || !p.HasRole("echoer") || p.TokenID != id {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+	if p, err = auth.Authenticate("wibble"); err != nil || p.Name != "bob" {
+		t.Fatalf("expected bob, got %v, %v", p, err)
+	}
+	if _, err = auth.Authenticate(id + ".wrong"); err == nil {
+		t.Fatal("expected a wrong secret to fail")
+	}
+}
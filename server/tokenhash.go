@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Token hashing algorithms. Use SHA256 for high-entropy generated tokens,
+// and Bcrypt or Argon2id for low-entropy human-chosen secrets.
+const (
+	HashSHA256   = "sha256"
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// argon2id parameters, as recommended by RFC 9106 for memory-constrained environments
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+)
+
+// limits on the parameters of stored hashes, so that a bad token file cannot
+// make verification panic or use unreasonable time & memory on every request
+const (
+	argonMaxTime   = 64
+	argonMaxMemory = 256 * 1024 // KiB
+	bcryptMaxCost  = 14
+)
+
+// NewToken generates a random bearer token in the form "<id>.<secret>".
+// The ID is not secret and is used to find the token's hash, so that
+// the secret only ever needs to be compared with one stored hash.
+func NewToken() (id string, token string, err error) {
+	idBuf := make([]byte, 8)
+	if _, err = rand.Read(idBuf); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	id = hex.EncodeToString(idBuf)
+	return id, id + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// SplitToken separates a token created by NewToken into its ID and secret.
+func SplitToken(token string) (id string, secret string, ok bool) {
+	return strings.Cut(token, ".")
+}
+
+// HashToken creates a salted hash of a token secret using the given algorithm.
+func HashToken(alg, secret string) (string, error) {
+	switch alg {
+	case HashSHA256:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		sum := saltedSHA256(salt, secret)
+		return fmt.Sprintf("sha256$%s$%s", hex.EncodeToString(salt), hex.EncodeToString(sum)), nil
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		return string(hash), err
+	case HashArgon2id:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(secret), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argonMemory, argonTime, argonThreads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("unsupported token hash algorithm: %s", alg)
+	}
+}
+
+// VerifyTokenHash checks, in constant time, that the secret matches a hash created by HashToken.
+func VerifyTokenHash(encoded, secret string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "sha256$"):
+		salt, expected, err := parseSHA256Hash(encoded)
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare(expected, saltedSHA256(salt, secret)) == 1, nil
+	case strings.HasPrefix(encoded, "$2"):
+		if err := checkBcryptHash(encoded); err != nil {
+			return false, err
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(secret))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		h, err := parseArgon2idHash(encoded)
+		if err != nil {
+			return false, err
+		}
+		actual := argon2.IDKey([]byte(secret), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(h.key, actual) == 1, nil
+	default:
+		return false, fmt.Errorf("unsupported token hash")
+	}
+}
+
+// CheckTokenHash checks that a hash created by HashToken is well-formed and within
+// the supported cost limits, without the expense of verifying a secret against it.
+func CheckTokenHash(encoded string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(encoded, "sha256$"):
+		_, _, err = parseSHA256Hash(encoded)
+	case strings.HasPrefix(encoded, "$2"):
+		err = checkBcryptHash(encoded)
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		_, err = parseArgon2idHash(encoded)
+	default:
+		err = fmt.Errorf("unsupported token hash")
+	}
+	return err
+}
+
+func parseSHA256Hash(encoded string) (salt []byte, sum []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("malformed sha256 hash")
+	}
+	salt, err = hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed sha256 salt: %w", err)
+	}
+	sum, err = hex.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed sha256 hash: %w", err)
+	}
+	return salt, sum, nil
+}
+
+func checkBcryptHash(encoded string) error {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return fmt.Errorf("malformed bcrypt hash: %w", err)
+	}
+	if cost > bcryptMaxCost {
+		return fmt.Errorf("unsupported bcrypt cost: %d", cost)
+	}
+	return nil
+}
+
+type argon2idHash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2idHash(encoded string) (*argon2idHash, error) {
+	var version int
+	h := &argon2idHash{}
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if h.time < 1 || h.time > argonMaxTime {
+		return nil, fmt.Errorf("unsupported argon2id time: %d", h.time)
+	}
+	if h.threads < 1 {
+		return nil, fmt.Errorf("unsupported argon2id parallelism: %d", h.threads)
+	}
+	if h.memory < 8*uint32(h.threads) || h.memory > argonMaxMemory {
+		return nil, fmt.Errorf("unsupported argon2id memory: %d KiB", h.memory)
+	}
+	var err error
+	h.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	h.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	if len(h.salt) == 0 || len(h.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2id hash: empty salt or key")
+	}
+	return h, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+func saltedSHA256(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return h.Sum(nil)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyTokenHashMalformedArgon2id(t *testing.T) {
+	valid, err := HashToken(HashArgon2id, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "too few parts", encoded: "$argon2id$v=19$m=65536,t=3,p=4$" + salt},
+		{name: "bad version", encoded: "$argon2id$v=16$m=65536,t=3,p=4$" + salt + "$" + key},
+		{name: "bad parameters", encoded: "$argon2id$v=19$m=lots$" + salt + "$" + key},
+		{name: "no parallelism", encoded: "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key},
+		{name: "no time", encoded: "$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + key},
+		{name: "too much time", encoded: "$argon2id$v=19$m=65536,t=1000000,p=4$" + salt + "$" + key},
+		{name: "no memory", encoded: "$argon2id$v=19$m=0,t=3,p=4$" + salt + "$" + key},
+		{name: "too much memory", encoded: "$argon2id$v=19$m=4294967295,t=3,p=4$" + salt + "$" + key},
+		{name: "over 256 MiB", encoded: "$argon2id$v=19$m=262145,t=3,p=4$" + salt + "$" + key},
+		{name: "empty salt", encoded: "$argon2id$v=19$m=65536,t=3,p=4$$" + key},
+		{name: "bad salt", encoded: "$argon2id$v=19$m=65536,t=3,p=4$!!!$" + key},
+		{name: "empty key", encoded: "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$"},
+		{name: "bad key", encoded: "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$!!!"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := CheckTokenHash(tc.encoded); err == nil {
+				t.Error("expected CheckTokenHash to fail")
+			}
+			ok, err := VerifyTokenHash(tc.encoded, "secret")
+			if err == nil || ok {
+				t.Errorf("expected an error, got ok=%v", ok)
+			}
+		})
+	}
+
+	ok, err := VerifyTokenHash(valid, "secret")
+	if err != nil || !ok {
+		t.Errorf("expected valid hash to verify, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCheckTokenHash(t *testing.T) {
+	for _, alg := range []string{HashSHA256, HashBcrypt, HashArgon2id} {
+		hash, err := HashToken(alg, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckTokenHash(hash); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+	}
+	expensive, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// raise the cost without spending the time to compute it
+	expensive = append([]byte("$2a$31"), expensive[6:]...)
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "unknown algorithm", encoded: "md5$abc"},
+		{name: "malformed sha256", encoded: "sha256$zz$00"},
+		{name: "malformed bcrypt", encoded: "$2a$10$short"},
+		{name: "expensive bcrypt", encoded: string(expensive)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := CheckTokenHash(tc.encoded); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes TLS material and protocol settings.
+type Config struct {
+	// CAFiles are PEM bundles of the CAs trusted to issue peer certificates.
+	CAFiles  []string `yaml:"ca_files"`
+	CertFile string   `yaml:"cert_file"`
+	KeyFile  string   `yaml:"key_file"`
+	// KeyPassphraseFile holds the passphrase of an encrypted PKCS#8 key file.
+	KeyPassphraseFile string `yaml:"key_passphrase_file"`
+	// KeyPassphrase decrypts an encrypted PKCS#8 key file when there is no
+	// KeyPassphraseFile. It is never read from config files.
+	KeyPassphrase string `yaml:"-"`
+	// MinVersion is "1.2" or "1.3", and defaults to "1.2".
+	MinVersion string `yaml:"min_version"`
+	// CipherSuites are Go cipher suite names (e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256),
+	// and only apply to TLS 1.2 as TLS 1.3 suites are not configurable.
+	CipherSuites []string `yaml:"cipher_suites"`
+	// Curves are key exchange preferences: X25519, P256, P384 or P521.
+	Curves []string `yaml:"curves"`
+	// ServerName is the name that clients expect in the server's certificate.
+	ServerName string `yaml:"server_name"`
+}
+
+// Server creates a tls.Config for listeners. Client certificates are
+// verified against the CA bundles unless clientAuth is tls.NoClientCert.
+func (c Config) Server(clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	cfg, err := c.base()
+	if err != nil {
+		return nil, err
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("server cert & key files are required")
+	}
+	cert, err := c.keyPair()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	cfg.ClientAuth = clientAuth
+	if clientAuth != tls.NoClientCert {
+		cfg.ClientCAs, err = c.certPool()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// Client creates a tls.Config for connections to a server, which
+// authenticates with a client certificate when one is configured.
+func (c Config) Client() (*tls.Config, error) {
+	cfg, err := c.base()
+	if err != nil {
+		return nil, err
+	}
+	cfg.RootCAs, err = c.certPool()
+	if err != nil {
+		return nil, err
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := c.keyPair()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	cfg.ServerName = c.ServerName
+	return cfg, nil
+}
+
+func (c Config) keyPair() (tls.Certificate, error) {
+	passphrase := []byte(c.KeyPassphrase)
+	if c.KeyPassphraseFile != "" {
+		var err error
+		if passphrase, err = ReadPassphrase(c.KeyPassphraseFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	cert, err := LoadKeyPair(c.CertFile, c.KeyFile, passphrase)
+	if err != nil {
+		return cert, fmt.Errorf("failed to load cert & key files: %w", err)
+	}
+	return cert, nil
+}
+
+func (c Config) base() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch c.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version: %s", c.MinVersion)
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+	for _, name := range c.Curves {
+		id, ok := curves[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve: %s", name)
+		}
+		cfg.CurvePreferences = append(cfg.CurvePreferences, id)
+	}
+	return cfg, nil
+}
+
+func (c Config) certPool() (*x509.CertPool, error) {
+	if len(c.CAFiles) == 0 {
+		return nil, fmt.Errorf("at least one CA file is required")
+	}
+	pool := x509.NewCertPool()
+	for _, caFile := range c.CAFiles {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+		}
+		if ok := pool.AppendCertsFromPEM(caCert); !ok {
+			return nil, fmt.Errorf("failed to add CA bundle %s into cert pool", caFile)
+		}
+	}
+	return pool, nil
+}
+
+func (c Config) caCerts() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, caFile := range c.CAFiles {
+		buf, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+		}
+		for {
+			var block *pem.Block
+			block, buf = pem.Decode(buf)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("bad certificate in CA bundle %s: %w", caFile, err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// only allow the suites that Go considers secure
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// LoadFile reads settings from a YAML or JSON file on top of the given config.
+func LoadFile(filename string, cfg Config) (Config, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, fmt.Errorf("cannot read TLS config: %w", err)
+	}
+	if err = yaml.Unmarshal(buf, &cfg); err != nil {
+		return cfg, fmt.Errorf("cannot parse TLS config: %w", err)
+	}
+	return cfg, nil
+}
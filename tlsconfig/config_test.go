@@ -0,0 +1,59 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestConfigBase(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		minVersion uint16
+		suites     []uint16
+		curves     []tls.CurveID
+		wantErr    bool
+	}{
+		{name: "defaults", minVersion: tls.VersionTLS12},
+		{name: "TLS 1.3", cfg: Config{MinVersion: "1.3"}, minVersion: tls.VersionTLS13},
+		{name: "TLS 1.1", cfg: Config{MinVersion: "1.1"}, wantErr: true},
+		{
+			name:       "cipher suites",
+			cfg:        Config{CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}},
+			minVersion: tls.VersionTLS12,
+			suites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		},
+		{name: "insecure cipher suite", cfg: Config{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, wantErr: true},
+		{
+			name:       "curves",
+			cfg:        Config{Curves: []string{"x25519", "P256"}},
+			minVersion: tls.VersionTLS12,
+			curves:     []tls.CurveID{tls.X25519, tls.CurveP256},
+		},
+		{name: "unknown curve", cfg: Config{Curves: []string{"P224"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.cfg.base()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.MinVersion != tt.minVersion {
+				t.Errorf("got min version %x, want %x", cfg.MinVersion, tt.minVersion)
+			}
+			if !slices.Equal(cfg.CipherSuites, tt.suites) {
+				t.Errorf("got cipher suites %v, want %v", cfg.CipherSuites, tt.suites)
+			}
+			if !slices.Equal(cfg.CurvePreferences, tt.curves) {
+				t.Errorf("got curves %v, want %v", cfg.CurvePreferences, tt.curves)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/x509"
+	"expvar"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// remaining validity in seconds, keyed by certificate
+var certExpiry = expvar.NewMap("tls_cert_expiry_seconds")
+
+// ExpiryThresholds decide how loudly to complain about certificates that are about to expire.
+type ExpiryThresholds struct {
+	Warn     time.Duration
+	Critical time.Duration
+}
+
+// MonitorExpiry checks the server certificate chain and CA certificates now, and then
+// every interval until the context is cancelled, unless the interval is not positive.
+// Certificates that expire within the thresholds are logged, and the remaining validity
+// of every certificate is published as the "tls_cert_expiry_seconds" expvar.
+func MonitorExpiry(ctx context.Context, r *Reloader, thresholds ExpiryThresholds, interval time.Duration) {
+	check := func() {
+		checkExpiry("server", r.Leaf(), thresholds)
+		for _, ca := range r.Intermediates() {
+			checkExpiry(fmt.Sprintf("intermediate:%s", ca.Subject.CommonName), ca, thresholds)
+		}
+		for _, ca := range r.CACerts() {
+			checkExpiry(fmt.Sprintf("ca:%s", ca.Subject.CommonName), ca, thresholds)
+		}
+	}
+	check()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+}
+
+func checkExpiry(name string, cert *x509.Certificate, thresholds ExpiryThresholds) {
+	remaining := time.Until(cert.NotAfter)
+	v := new(expvar.Float)
+	v.Set(remaining.Seconds())
+	certExpiry.Set(name, v)
+	ll := log.WithField("cert", name).
+		WithField("serial", cert.SerialNumber).
+		WithField("not_after", cert.NotAfter).
+		WithField("remaining", remaining.Round(time.Minute))
+	switch {
+	case remaining <= 0:
+		ll.Error("certificate has expired")
+	case remaining <= thresholds.Critical:
+		ll.Error("certificate is about to expire")
+	case remaining <= thresholds.Warn:
+		ll.Warn("certificate expires soon")
+	}
+}
@@ -0,0 +1,120 @@
+package tlsconfig
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+// Flags holds TLS command line flags.
+type Flags struct {
+	fs         *flag.FlagSet
+	configFile *string
+	values     map[string]*string
+	defaults   Config
+}
+
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	get   func(Config) string
+	set   func(*Config, string)
+}
+
+var settings = []setting{
+	{
+		flag: "tls-ca", env: "TLS_CA_FILES", usage: "comma-separated CA bundle files",
+		get: func(c Config) string { return strings.Join(c.CAFiles, ",") },
+		set: func(c *Config, v string) { c.CAFiles = splitList(v) },
+	},
+	{
+		flag: "tls-cert", env: "TLS_CERT_FILE", usage: "certificate file",
+		get: func(c Config) string { return c.CertFile },
+		set: func(c *Config, v string) { c.CertFile = v },
+	},
+	{
+		flag: "tls-key", env: "TLS_KEY_FILE", usage: "private key file",
+		get: func(c Config) string { return c.KeyFile },
+		set: func(c *Config, v string) { c.KeyFile = v },
+	},
+	{
+		flag: "tls-key-passphrase-file", env: "TLS_KEY_PASSPHRASE_FILE", usage: "passphrase file for an encrypted private key",
+		get: func(c Config) string { return c.KeyPassphraseFile },
+		set: func(c *Config, v string) { c.KeyPassphraseFile = v },
+	},
+	{
+		flag: "tls-min-version", env: "TLS_MIN_VERSION", usage: "minimum TLS version (1.2 or 1.3)",
+		get: func(c Config) string { return c.MinVersion },
+		set: func(c *Config, v string) { c.MinVersion = v },
+	},
+	{
+		flag: "tls-ciphers", env: "TLS_CIPHER_SUITES", usage: "comma-separated TLS 1.2 cipher suites",
+		get: func(c Config) string { return strings.Join(c.CipherSuites, ",") },
+		set: func(c *Config, v string) { c.CipherSuites = splitList(v) },
+	},
+	{
+		flag: "tls-curves", env: "TLS_CURVES", usage: "comma-separated curve preferences (X25519, P256, P384, P521)",
+		get: func(c Config) string { return strings.Join(c.Curves, ",") },
+		set: func(c *Config, v string) { c.Curves = splitList(v) },
+	},
+	{
+		flag: "tls-server-name", env: "TLS_SERVER_NAME", usage: "expected server certificate name",
+		get: func(c Config) string { return c.ServerName },
+		set: func(c *Config, v string) { c.ServerName = v },
+	},
+}
+
+// RegisterFlags adds TLS flags to the flag set. Settings come from the given
+// defaults, then the -tls-config file, then TLS_* environment variables, and
+// finally any flags given on the command line.
+func RegisterFlags(fs *flag.FlagSet, defaults Config) *Flags {
+	f := &Flags{
+		fs:         fs,
+		configFile: fs.String("tls-config", os.Getenv("TLS_CONFIG"), "YAML or JSON TLS config file"),
+		values:     make(map[string]*string),
+		defaults:   defaults,
+	}
+	for _, s := range settings {
+		f.values[s.flag] = fs.String(s.flag, s.get(defaults), s.usage+" (env "+s.env+")")
+	}
+	return f
+}
+
+// Config resolves the TLS settings once the flags have been parsed.
+func (f *Flags) Config() (Config, error) {
+	cfg := f.defaults
+	if *f.configFile != "" {
+		var err error
+		if cfg, err = LoadFile(*f.configFile, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			s.set(&cfg, value)
+		}
+	}
+	// keep passphrases out of config files & process listings
+	if value, ok := os.LookupEnv("TLS_KEY_PASSPHRASE"); ok {
+		cfg.KeyPassphrase = value
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == fl.Name {
+				s.set(&cfg, *f.values[s.flag])
+			}
+		}
+	})
+	return cfg, nil
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,162 @@
+package tlsconfig
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlagsConfig(t *testing.T) {
+	defaults := Config{
+		CAFiles:  []string{"default-ca.crt"},
+		CertFile: "default.crt",
+		KeyFile:  "default.key",
+	}
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "tls.yaml")
+	config := `
+ca_files: [file-ca.crt, file-intermediate.crt]
+cert_file: file.crt
+min_version: "1.3"
+key_passphrase: from-file
+`
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want Config
+	}{
+		{
+			name: "defaults",
+			want: defaults,
+		},
+		{
+			name: "file over defaults",
+			args: []string{"-tls-config", configFile},
+			want: Config{
+				CAFiles:    []string{"file-ca.crt", "file-intermediate.crt"},
+				CertFile:   "file.crt",
+				KeyFile:    "default.key",
+				MinVersion: "1.3",
+			},
+		},
+		{
+			name: "file from env",
+			env:  map[string]string{"TLS_CONFIG": configFile},
+			want: Config{
+				CAFiles:    []string{"file-ca.crt", "file-intermediate.crt"},
+				CertFile:   "file.crt",
+				KeyFile:    "default.key",
+				MinVersion: "1.3",
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"TLS_CERT_FILE": "env.crt", "TLS_CA_FILES": "env-ca.crt, ,other-ca.crt", "TLS_KEY_PASSPHRASE": "from-env"},
+			args: []string{"-tls-config", configFile},
+			want: Config{
+				CAFiles:       []string{"env-ca.crt", "other-ca.crt"},
+				CertFile:      "env.crt",
+				KeyFile:       "default.key",
+				KeyPassphrase: "from-env",
+				MinVersion:    "1.3",
+			},
+		},
+		{
+			name: "flag over env",
+			env:  map[string]string{"TLS_CERT_FILE": "env.crt", "TLS_KEY_FILE": "env.key"},
+			args: []string{"-tls-config", configFile, "-tls-cert", "flag.crt", "-tls-min-version", "1.2"},
+			want: Config{
+				CAFiles:    []string{"file-ca.crt", "file-intermediate.crt"},
+				CertFile:   "flag.crt",
+				KeyFile:    "env.key",
+				MinVersion: "1.2",
+			},
+		},
+		{
+			name: "empty flag clears",
+			env:  map[string]string{"TLS_SERVER_NAME": "env.example.com"},
+			args: []string{"-tls-server-name", "", "-tls-ca", ""},
+			want: Config{
+				CertFile: "default.crt",
+				KeyFile:  "default.key",
+			},
+		},
+		{
+			name: "flag list",
+			args: []string{"-tls-ciphers", "TLS_AES_128_GCM_SHA256,TLS_CHACHA20_POLY1305_SHA256", "-tls-curves", "X25519"},
+			want: Config{
+				CAFiles:      []string{"default-ca.crt"},
+				CertFile:     "default.crt",
+				KeyFile:      "default.key",
+				CipherSuites: []string{"TLS_AES_128_GCM_SHA256", "TLS_CHACHA20_POLY1305_SHA256"},
+				Curves:       []string{"X25519"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := RegisterFlags(fs, defaults)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			got, err := flags.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagsConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(badFile, []byte("cert_file: [nope"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, configFile := range map[string]string{
+		"missing file": filepath.Join(dir, "missing.yaml"),
+		"bad file":     badFile,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			flags := RegisterFlags(fs, Config{})
+			if err := fs.Parse([]string{"-tls-config", configFile}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := flags.Config(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// clearEnv unsets the TLS environment variables for the rest of the test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	keys := []string{"TLS_CONFIG", "TLS_KEY_PASSPHRASE"}
+	for _, s := range settings {
+		keys = append(keys, s.env)
+	}
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
@@ -0,0 +1,83 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// ReadPrivateKey reads a PEM-encoded PKCS#8, PKCS#1 or SEC1 private key,
+// using the passphrase to decrypt encrypted PKCS#8 keys.
+func ReadPrivateKey(keyFile string, passphrase []byte) (crypto.Signer, error) {
+	buf, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key: %w", err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	var key any
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("%s is encrypted, but no passphrase was given", keyFile)
+		}
+		key, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, passphrase)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key %s: %w", keyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// LoadKeyPair works like tls.LoadX509KeyPair, but also
+// accepts keys that are encrypted with the passphrase.
+func LoadKeyPair(certFile, keyFile string, passphrase []byte) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if bytes.Contains(keyPEM, []byte("ENCRYPTED PRIVATE KEY")) {
+		key, err := ReadPrivateKey(keyFile, passphrase)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		// only keep the decrypted key in memory
+		buf, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: buf})
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// ReadPassphrase reads a passphrase from a file, ignoring any trailing newline.
+func ReadPassphrase(filename string) ([]byte, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read passphrase: %w", err)
+	}
+	return bytes.TrimRight(buf, "\r\n"), nil
+}
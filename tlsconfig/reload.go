@@ -0,0 +1,119 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tomcz/example-grpc/filewatch"
+)
+
+// Reloader keeps a server's certificate, key and client CA pool
+// up to date with their files, so that they can be rotated without
+// restarting the server.
+type Reloader struct {
+	cfg        Config
+	clientAuth tls.ClientAuthType
+	current    atomic.Pointer[tls.Config]
+	certs      atomic.Pointer[loadedCerts]
+}
+
+type loadedCerts struct {
+	leaf          *x509.Certificate
+	intermediates []*x509.Certificate
+	cas           []*x509.Certificate
+}
+
+// NewReloader loads the server's TLS material and then reloads it whenever
+// the files change, until the context is cancelled. New material is only
+// swapped in once the certificate & key pair and CA bundles are valid.
+func NewReloader(ctx context.Context, cfg Config, clientAuth tls.ClientAuthType) (*Reloader, error) {
+	r := &Reloader{cfg: cfg, clientAuth: clientAuth}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	files := []string{cfg.CertFile, cfg.KeyFile}
+	if cfg.KeyPassphraseFile != "" {
+		files = append(files, cfg.KeyPassphraseFile)
+	}
+	if clientAuth != tls.NoClientCert {
+		files = append(files, cfg.CAFiles...)
+	}
+	if err := filewatch.Files(ctx, r.onChange, files...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig creates a tls.Config for a listener that always uses the
+// current TLS material and negotiates the given application protocols.
+func (r *Reloader) ServerConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		NextProtos: nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current.Load().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := r.current.Load().Clone()
+			cfg.NextProtos = slices.Clone(nextProtos)
+			return cfg, nil
+		},
+	}
+}
+
+// NotAfter returns the expiry time of the current server certificate.
+func (r *Reloader) NotAfter() time.Time {
+	return r.certs.Load().leaf.NotAfter
+}
+
+// Leaf returns the current server certificate.
+func (r *Reloader) Leaf() *x509.Certificate {
+	return r.certs.Load().leaf
+}
+
+// Intermediates returns the intermediate CA certificates sent along with the server certificate.
+func (r *Reloader) Intermediates() []*x509.Certificate {
+	return r.certs.Load().intermediates
+}
+
+// CACerts returns the certificates in the current CA bundles.
+func (r *Reloader) CACerts() []*x509.Certificate {
+	return r.certs.Load().cas
+}
+
+func (r *Reloader) onChange() {
+	if err := r.reload(); err != nil {
+		log.WithError(err).Error("TLS reload rejected, keeping previous cert & key")
+	}
+}
+
+func (r *Reloader) reload() error {
+	cfg, err := r.cfg.Server(r.clientAuth)
+	if err != nil {
+		return err
+	}
+	chain := make([]*x509.Certificate, len(cfg.Certificates[0].Certificate))
+	for i, der := range cfg.Certificates[0].Certificate {
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return fmt.Errorf("failed to parse server cert chain: %w", err)
+		}
+	}
+	leaf := chain[0]
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("server cert expired at %s", leaf.NotAfter)
+	}
+	cas, err := r.cfg.caCerts()
+	if err != nil {
+		return err
+	}
+	r.current.Store(cfg)
+	r.certs.Store(&loadedCerts{leaf: leaf, intermediates: chain[1:], cas: cas})
+	log.WithField("cert", r.cfg.CertFile).WithField("not_after", leaf.NotAfter).Info("loaded server TLS material")
+	return nil
+}
@@ -0,0 +1,216 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPKI struct {
+	t      *testing.T
+	dir    string
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+	caPEM  []byte
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testPKI{
+		t:      t,
+		dir:    t.TempDir(),
+		caKey:  key,
+		caCert: cert,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue creates a server certificate and returns its PEM-encoded cert and key.
+func (p *testPKI) issue(serial int64, notAfter time.Time) ([]byte, []byte) {
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.caCert, &key.PublicKey, p.caKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (p *testPKI) write(name string, buf []byte) string {
+	p.t.Helper()
+	filename := filepath.Join(p.dir, name)
+	if err := os.WriteFile(filename, buf, 0600); err != nil {
+		p.t.Fatal(err)
+	}
+	return filename
+}
+
+func (p *testPKI) config() Config {
+	return Config{
+		CAFiles:  []string{filepath.Join(p.dir, "ca.crt")},
+		CertFile: filepath.Join(p.dir, "server.crt"),
+		KeyFile:  filepath.Join(p.dir, "server.key"),
+	}
+}
+
+func TestReloaderRejectsBadMaterial(t *testing.T) {
+	pki := newTestPKI(t)
+	validCert, validKey := pki.issue(10, time.Now().Add(time.Hour))
+	otherCert, _ := pki.issue(11, time.Now().Add(time.Hour))
+	expiredCert, expiredKey := pki.issue(12, time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name string
+		cert []byte
+		key  []byte
+		ca   []byte
+	}{
+		{name: "cert without its key", cert: otherCert, key: validKey, ca: pki.caPEM},
+		{name: "expired cert", cert: expiredCert, key: expiredKey, ca: pki.caPEM},
+		{name: "empty cert", cert: nil, key: validKey, ca: pki.caPEM},
+		{name: "truncated cert", cert: validCert[:len(validCert)/2], key: validKey, ca: pki.caPEM},
+		{name: "garbage key", cert: validCert, key: []byte("wibble"), ca: pki.caPEM},
+		{name: "empty CA bundle", cert: validCert, key: validKey, ca: nil},
+		{name: "garbage CA bundle", cert: validCert, key: validKey, ca: []byte("wibble")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pki.write("ca.crt", pki.caPEM)
+			pki.write("server.crt", validCert)
+			pki.write("server.key", validKey)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r, err := NewReloader(ctx, pki.config(), tls.RequireAndVerifyClientCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := r.current.Load()
+
+			pki.write("ca.crt", tt.ca)
+			pki.write("server.crt", tt.cert)
+			pki.write("server.key", tt.key)
+			if err = r.reload(); err == nil {
+				t.Fatal("expected the reload to be rejected")
+			}
+			if r.current.Load() != before {
+				t.Error("rejected material replaced the TLS config")
+			}
+			if serial := r.Leaf().SerialNumber.Int64(); serial != 10 {
+				t.Errorf("expected the previous cert to be kept, got serial %d", serial)
+			}
+			if len(r.CACerts()) != 1 {
+				t.Errorf("expected the previous CA bundle to be kept, got %d CAs", len(r.CACerts()))
+			}
+		})
+	}
+}
+
+func TestNewReloaderRejectsBadMaterial(t *testing.T) {
+	pki := newTestPKI(t)
+	_, key := pki.issue(10, time.Now().Add(time.Hour))
+	expiredCert, expiredKey := pki.issue(11, time.Now().Add(-time.Minute))
+	otherCert, _ := pki.issue(12, time.Now().Add(time.Hour))
+	pki.write("ca.crt", pki.caPEM)
+
+	for name, files := range map[string][2][]byte{
+		"expired cert":         {expiredCert, expiredKey},
+		"cert without its key": {otherCert, key},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pki.write("server.crt", files[0])
+			pki.write("server.key", files[1])
+			if _, err := NewReloader(context.Background(), pki.config(), tls.NoClientCert); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReloaderWatchesFiles(t *testing.T) {
+	pki := newTestPKI(t)
+	cert, key := pki.issue(10, time.Now().Add(time.Hour))
+	pki.write("ca.crt", pki.caPEM)
+	pki.write("server.crt", cert)
+	pki.write("server.key", key)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := NewReloader(ctx, pki.config(), tls.NoClientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a half-finished rotation must not be picked up
+	newCert, newKey := pki.issue(20, time.Now().Add(2*time.Hour))
+	pki.write("server.crt", newCert)
+	time.Sleep(500 * time.Millisecond)
+	if serial := r.Leaf().SerialNumber.Int64(); serial != 10 {
+		t.Fatalf("expected the previous cert to be kept, got serial %d", serial)
+	}
+
+	pki.write("server.key", newKey)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Leaf().SerialNumber.Int64() != 20 {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated cert was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, err := r.ServerConfig("h2").GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(got.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.SerialNumber.Int64() != 20 {
+		t.Errorf("listeners still get serial %d", leaf.SerialNumber.Int64())
+	}
+}